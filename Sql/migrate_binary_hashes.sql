@@ -0,0 +1,118 @@
+-- ///////////////////////////////////////////////////////
+
+-- Migrates a database created by the original schema, with BINARY(16)
+-- MD5 hashes set by triggers, to the current schema.sql:
+--
+--   mysql nuseagent < migrate_binary_hashes.sql
+--   mysql nuseagent < schema.sql
+--
+-- The old tables are renamed with a _v1 suffix and their rows copied
+-- into the new ones, rehashed as nusetextd now hashes them: the
+-- uppercase hex SHA1 (generateHash) of the url, the topic label, or the
+-- entity id falling back to the matched text. Links are tagged with the
+-- textrazor provider, the only one there was. Entity scores and
+-- mentions move to the article_has_entities link. Drop the _v1 tables
+-- once the copy has been checked.
+
+-- ///////////////////////////////////////////////////////
+
+DROP TRIGGER IF EXISTS article_generate_hash;
+DROP TRIGGER IF EXISTS topic_generate_hash;
+DROP TRIGGER IF EXISTS entity_generate_hash;
+
+RENAME TABLE
+    article_has_topics TO article_has_topics_v1,
+    article_has_entities TO article_has_entities_v1,
+    articles TO articles_v1,
+    topics TO topics_v1,
+    entities TO entities_v1;
+
+-- ///////////////////////////////////////////////////////
+
+CREATE TABLE articles (
+    hash CHAR(40) CHARACTER SET ascii NOT NULL,
+    url TEXT,
+    feedId BIGINT,
+    feedTitle TINYTEXT,
+    publishedAt DATETIME,
+    traceId VARCHAR(64),
+    PRIMARY KEY (hash)
+);
+
+INSERT IGNORE INTO articles (hash, url)
+SELECT UPPER(SHA1(url)), url
+FROM articles_v1
+WHERE url IS NOT NULL;
+
+-- ///////////////////////////////////////////////////////
+
+CREATE TABLE topics (
+    hash CHAR(40) CHARACTER SET ascii NOT NULL,
+    label TINYTEXT,
+    score DOUBLE,
+    wikiLink TEXT,
+    wikidataId VARCHAR(32),
+    PRIMARY KEY (hash)
+);
+
+INSERT IGNORE INTO topics (hash, label, score, wikiLink, wikidataId)
+SELECT UPPER(SHA1(label)), label, score, wikiLink, CONCAT('Q', wikidataId)
+FROM topics_v1
+WHERE label IS NOT NULL;
+
+CREATE TABLE article_has_topics (
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    topicHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    PRIMARY KEY (articleHash, topicHash),
+    FOREIGN KEY (articleHash) REFERENCES articles(hash),
+    FOREIGN KEY (topicHash) REFERENCES topics(hash)
+);
+
+INSERT IGNORE INTO article_has_topics (articleHash, topicHash, provider)
+SELECT UPPER(SHA1(a.url)), UPPER(SHA1(t.label)), 'textrazor'
+FROM article_has_topics_v1 l
+JOIN articles_v1 a ON a.hash = l.articleHash
+JOIN topics_v1 t ON t.hash = l.topicHash
+WHERE a.url IS NOT NULL AND t.label IS NOT NULL;
+
+-- ///////////////////////////////////////////////////////
+
+CREATE TABLE entities (
+    hash            CHAR(40) CHARACTER SET ascii NOT NULL,
+	entityId        TEXT,
+	entityEnglishId TEXT,
+	`type`          TEXT,
+	freebaseTypes   TEXT,
+	freebaseId      TEXT,
+	wikidataId      TEXT,
+	`data`          TEXT,
+	wikiLink        TEXT,
+    PRIMARY KEY (hash)
+);
+
+INSERT IGNORE INTO entities (hash, entityId, entityEnglishId, `type`, freebaseTypes, freebaseId, `data`, wikiLink)
+SELECT UPPER(SHA1(COALESCE(NULLIF(entityId, ''), matchedText))), entityId, entityEnglishId, `type`, freebaseTypes, freebaseId, `data`, wikiLink
+FROM entities_v1
+WHERE COALESCE(NULLIF(entityId, ''), matchedText) IS NOT NULL;
+
+CREATE TABLE article_has_entities (
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    entityHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    confidenceScore DOUBLE,
+    relevanceScore DOUBLE,
+    matchedText TEXT,
+    matchingTokens TEXT,
+    PRIMARY KEY (articleHash, entityHash),
+    FOREIGN KEY (articleHash) REFERENCES articles(hash),
+    FOREIGN KEY (entityHash) REFERENCES entities(hash)
+);
+
+INSERT IGNORE INTO article_has_entities (articleHash, entityHash, provider, confidenceScore, relevanceScore, matchedText, matchingTokens)
+SELECT UPPER(SHA1(a.url)), UPPER(SHA1(COALESCE(NULLIF(e.entityId, ''), e.matchedText))), 'textrazor',
+    e.confidenceScore, e.relevanceScore, e.matchedText, e.matchingTokens
+FROM article_has_entities_v1 l
+JOIN articles_v1 a ON a.hash = l.articleHash
+JOIN entities_v1 e ON e.hash = l.entityHash
+WHERE a.url IS NOT NULL AND COALESCE(NULLIF(e.entityId, ''), e.matchedText) IS NOT NULL;
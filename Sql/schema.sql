@@ -1,50 +1,48 @@
 
 -- ///////////////////////////////////////////////////////
 
+-- Every hash column holds the uppercase hex SHA1 nusetextd computes
+-- (generateHash): of the url for articles, the label for topics and
+-- the entity id for entities.
+--
+-- The provider column of each article_has_ link is the provider that
+-- found it, e.g. textrazor, or local for the lower confidence keywords
+-- and entities of the local fallback.
+--
+-- Databases created by the original schema, with BINARY(16) MD5
+-- hashes, are upgraded by migrate_binary_hashes.sql.
+
+-- ///////////////////////////////////////////////////////
+
+-- The feed columns are set from JSON article jobs, and are NULL for
+-- articles queued as a bare URL
 CREATE TABLE IF NOT EXISTS articles (
-    hash BINARY(16) NOT NULL,
+    hash CHAR(40) CHARACTER SET ascii NOT NULL,
     url TEXT,
+    feedId BIGINT,
+    feedTitle TINYTEXT,
+    publishedAt DATETIME,
+    traceId VARCHAR(64),
     PRIMARY KEY (hash)
 );
 
-DELIMITER $$
-
-CREATE TRIGGER article_generate_hash  
-BEFORE INSERT ON articles
-FOR EACH ROW  
-BEGIN  
-  NEW.hash = MD5(NEW.url)
-END $$
-
-DELIMITER ;
-
 -- ///////////////////////////////////////////////////////
 
 CREATE TABLE IF NOT EXISTS topics (
-    hash BINARY(16) NOT NULL,
+    hash CHAR(40) CHARACTER SET ascii NOT NULL,
     label TINYTEXT,
     score DOUBLE,
     wikiLink TEXT,
-    wikidataId INT
+    wikidataId VARCHAR(32),
     PRIMARY KEY (hash)    
 );
 
-DELIMITER $$
-
-CREATE TRIGGER topic_generate_hash  
-BEFORE INSERT ON topics
-FOR EACH ROW  
-BEGIN  
-  NEW.hash = MD5(NEW.label)
-END $$
-
-DELIMITER ;
-
 -- ///////////////////////////////////////////////////////
 
 CREATE TABLE IF NOT EXISTS article_has_topics (
-    articleHash BINARY(16) NOT NULL,
-    topicHash BINARY(16) NOT NULL,
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    topicHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    provider VARCHAR(32) NOT NULL,
     PRIMARY KEY (articleHash, topicHash),
     FOREIGN KEY (articleHash) REFERENCES articles(hash),
     FOREIGN KEY (topicHash) REFERENCES topics(hash)    
@@ -52,39 +50,108 @@ CREATE TABLE IF NOT EXISTS article_has_topics (
 
 -- ///////////////////////////////////////////////////////
 
+-- hash is of the entityId, or of the matched text for providers
+-- without entity ids
 CREATE TABLE IF NOT EXISTS entities (
-    hash            BINARY(16) NOT NULL,
+    hash            CHAR(40) CHARACTER SET ascii NOT NULL,
 	entityId        TEXT,
 	entityEnglishId TEXT,
-	confidenceScore DOUBLE,
 	`type`          TEXT,
 	freebaseTypes   TEXT,
 	freebaseId      TEXT,
-	matchingTokens  TEXT,
-	matchedText     TEXT,
+	wikidataId      TEXT,
 	`data`          TEXT,
-	relevanceScore  DOUBLE,
-	wikiLink        TEXT
-    PRIMARY KEY (entityHash)
+	wikiLink        TEXT,
+    PRIMARY KEY (hash)
 );
 
-DELIMITER $$
-
-CREATE TRIGGER entity_generate_hash  
-BEFORE INSERT ON entities
-FOR EACH ROW  
-BEGIN  
-  NEW.hash = MD5(NEW.matchedText)
-END $$
-
-DELIMITER ;
-
 -- ///////////////////////////////////////////////////////
 
+-- The scores and mentions of an entity in one article; matchedText is
+-- the first mention and matchingTokens the word positions of them all
 CREATE TABLE IF NOT EXISTS article_has_entities (
-    articleHash BINARY(16) NOT NULL,
-    entityHash BINARY(16) NOT NULL,
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    entityHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    confidenceScore DOUBLE,
+    relevanceScore DOUBLE,
+    matchedText TEXT,
+    matchingTokens TEXT,
     PRIMARY KEY (articleHash, entityHash),
     FOREIGN KEY (articleHash) REFERENCES articles(hash),
     FOREIGN KEY (entityHash) REFERENCES entities(hash)    
 );
+
+-- ///////////////////////////////////////////////////////
+
+CREATE TABLE IF NOT EXISTS coarse_topics (
+    hash CHAR(40) CHARACTER SET ascii NOT NULL,
+    label TINYTEXT,
+    wikiLink TEXT,
+    wikidataId VARCHAR(32),
+    PRIMARY KEY (hash)
+);
+
+-- ///////////////////////////////////////////////////////
+
+CREATE TABLE IF NOT EXISTS article_has_coarse_topics (
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    coarseTopicHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    score DOUBLE,
+    provider VARCHAR(32) NOT NULL,
+    PRIMARY KEY (articleHash, coarseTopicHash),
+    FOREIGN KEY (articleHash) REFERENCES articles(hash),
+    FOREIGN KEY (coarseTopicHash) REFERENCES coarse_topics(hash)
+);
+
+-- ///////////////////////////////////////////////////////
+
+-- response is the gzipped provider response body (e.g. TextRazor JSON),
+-- including sentences, relations and anything else not broken out into
+-- tables. The fetch columns are only set when nusetextd downloaded the
+-- article itself (-fetch-locally or the local provider).
+CREATE TABLE IF NOT EXISTS article_analyses (
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    analysedAt DATETIME NOT NULL,
+    language CHAR(3),
+    languageIsReliable BOOLEAN,
+    sentenceCount INT,
+    fetchStatus SMALLINT,
+    fetchedUrl TEXT,
+    contentLength INT,
+    response MEDIUMBLOB,
+    PRIMARY KEY (articleHash),
+    FOREIGN KEY (articleHash) REFERENCES articles(hash)
+);
+
+-- ///////////////////////////////////////////////////////
+
+-- The local provider's TF-IDF corpus: every article it has analysed, and
+-- the number of those articles each term appears in
+CREATE TABLE IF NOT EXISTS corpus_documents (
+    articleHash CHAR(40) CHARACTER SET ascii NOT NULL,
+    PRIMARY KEY (articleHash)
+);
+
+CREATE TABLE IF NOT EXISTS corpus_terms (
+    term VARCHAR(64) NOT NULL,
+    documents INT NOT NULL,
+    PRIMARY KEY (term)
+);
+
+-- ///////////////////////////////////////////////////////
+
+-- Why each buried job was buried, for the buried command. beanstalkd
+-- keeps no reason itself. Rows for jobs since deleted are cleared out
+-- by the buried command. attempts counts the failures of a job being
+-- retried, and is reset when it is buried.
+CREATE TABLE IF NOT EXISTS job_failures (
+    jobId BIGINT UNSIGNED NOT NULL,
+    tube VARCHAR(200) NOT NULL,
+    reason TEXT NOT NULL,
+    failedAt DATETIME NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (jobId),
+    KEY (tube)
+);
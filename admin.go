@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminServer serves the admin HTTP endpoints:
+//
+//	GET /workers             current worker count
+//	PUT /workers?count=N     grow or shrink the worker pool to N, up to -max-workers
+//	GET /tubes               per source tube article counts and backlog
+//	GET /metrics             metrics in the Prometheus text format
+//	GET /healthz             503 if any worker has stalled
+//	GET /readyz              503 if any dependency is unusable, with details
+type AdminServer struct {
+	*http.ServeMux
+	stack *Stack
+}
+
+// NewAdminServer AdminServer constructor
+func NewAdminServer(stack *Stack) *AdminServer {
+	as := &AdminServer{
+		ServeMux: http.NewServeMux(),
+		stack:    stack,
+	}
+	as.HandleFunc("/workers", as.workers)
+	as.HandleFunc("/tubes", as.tubes)
+	as.HandleFunc("/metrics", as.metrics)
+	as.HandleFunc("/healthz", as.healthz)
+	as.HandleFunc("/readyz", as.readyz)
+
+	return as
+}
+
+// workersResponse is the body returned by /workers
+type workersResponse struct {
+	Workers int    `json:"workers"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (as *AdminServer) workers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		config.Lock()
+		maxWorkers := config.maxWorkers
+		autoscale := config.autoscale
+		config.Unlock()
+
+		// The autoscaler would undo a manual resize at its next check
+		if autoscale {
+			writeJSON(w, http.StatusConflict, &workersResponse{Workers: as.stack.Len(), Error: "workers are autoscaled, see -autoscale"})
+			return
+		}
+
+		count, err := strconv.Atoi(r.FormValue("count"))
+		if err != nil || count < 0 || count > maxWorkers {
+			writeJSON(w, http.StatusBadRequest, &workersResponse{Workers: as.stack.Len(), Error: fmt.Sprintf("count must be an integer from 0 to %d, see -max-workers", maxWorkers)})
+			return
+		}
+
+		err = as.stack.Resize(count, func() *WorkerConfig { return newWorkerConfig(config) })
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, &workersResponse{Workers: as.stack.Len(), Error: err.Error()})
+			return
+		}
+		logger.Infof("Admin resized workers to %d", count)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, &workersResponse{Workers: as.stack.Len(), Error: "method not allowed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &workersResponse{Workers: as.stack.Len()})
+}
+
+// tubeResponse is a source tube in the body returned by /tubes
+type tubeResponse struct {
+	Name string `json:"name"`
+	TubeCounts
+	Ready  int `json:"ready"`
+	Buried int `json:"buried"`
+}
+
+// tubesResponse is the body returned by /tubes
+type tubesResponse struct {
+	Order string          `json:"order"`
+	Tubes []*tubeResponse `json:"tubes"`
+	Error string          `json:"error,omitempty"`
+}
+
+func (as *AdminServer) tubes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, &tubesResponse{Error: "method not allowed"})
+		return
+	}
+
+	config.Lock()
+	beanstalkdHost := config.beanstalkdHost
+	order := config.srcTubeOrder
+	config.Unlock()
+
+	counts := tubeStats.Snapshot()
+	res := &tubesResponse{Order: order}
+	for _, tube := range config.SourceTubeNames() {
+		res.Tubes = append(res.Tubes, &tubeResponse{Name: tube, TubeCounts: counts[tube]})
+	}
+
+	ba, err := DialBeanstalkAdmin(beanstalkdHost)
+	if err != nil {
+		res.Error = err.Error()
+		writeJSON(w, http.StatusServiceUnavailable, res)
+		return
+	}
+	defer ba.Close()
+
+	for _, t := range res.Tubes {
+		stats, err := ba.StatsTube(t.Name)
+		if err == ErrNotFound {
+			continue // no jobs have been put in the tube yet
+		}
+		if err != nil {
+			res.Error = err.Error()
+			writeJSON(w, http.StatusServiceUnavailable, res)
+			return
+		}
+		t.Ready = stats.CurrentJobsReady
+		t.Buried = stats.CurrentJobsBuried
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (as *AdminServer) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Write(w)
+
+	writeSample(w, "nusetextd_workers", "Running workers.", "gauge", float64(as.stack.Len()))
+	writeSample(w, "nusetextd_beanstalk_waiting_workers", "Workers waiting for a beanstalkd connection.", "gauge", float64(beanstalkState.Waiting()))
+	writeSample(w, "nusetextd_beanstalk_connections_lost_total", "Worker beanstalkd connections lost.", "counter", float64(beanstalkState.Lost()))
+	if quota != nil {
+		writeSample(w, "nusetextd_quota_limit", "Daily TextRazor request quota.", "gauge", float64(quota.Limit()))
+		writeSample(w, "nusetextd_quota_remaining", "TextRazor requests remaining in the current quota window.", "gauge", float64(quota.Remaining()))
+		writeSample(w, "nusetextd_quota_reset_timestamp_seconds", "When the current quota window ends.", "gauge", float64(quota.ResetAt().Unix()))
+	}
+}
+
+// healthResponse is the body returned by /healthz
+type healthResponse struct {
+	Healthy bool `json:"healthy"`
+	Workers int  `json:"workers"`
+	Stalled int  `json:"stalled"`
+}
+
+func (as *AdminServer) healthz(w http.ResponseWriter, r *http.Request) {
+	config.Lock()
+	window := time.Duration(config.workerStall) * time.Second
+	config.Unlock()
+
+	res := &healthResponse{
+		Workers: as.stack.Len(),
+		Stalled: workerHealth.Stalled(window),
+	}
+	res.Healthy = res.Stalled == 0
+
+	status := http.StatusOK
+	if !res.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, res)
+}
+
+// readyCheck is the state of a dependency in the body returned by /readyz
+type readyCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// readyResponse is the body returned by /readyz
+type readyResponse struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]*readyCheck `json:"checks"`
+}
+
+func (as *AdminServer) readyz(w http.ResponseWriter, r *http.Request) {
+	config.Lock()
+	beanstalkdHost := config.beanstalkdHost
+	db := config.db
+	provider := config.provider
+	fallbackProvider := config.fallbackProvider
+	keyed := config.textRazorAPIKey != ""
+	config.Unlock()
+
+	res := &readyResponse{
+		Ready: true,
+		Checks: map[string]*readyCheck{
+			"beanstalkd": checkBeanstalkd(beanstalkdHost, as.stack.Len()),
+			"mysql":      checkMySQL(db),
+			"textrazor":  checkTextRazor(provider, fallbackProvider, keyed),
+			"quota":      checkQuota(provider, fallbackProvider),
+		},
+	}
+	for _, c := range res.Checks {
+		res.Ready = res.Ready && c.OK
+	}
+
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, res)
+}
+
+// readyTimeout bounds each /readyz dependency check
+const readyTimeout = 2 * time.Second
+
+// checkBeanstalkd checks beanstalkd answers and every one of the workers
+// is watching the source tubes
+func checkBeanstalkd(host string, workers int) *readyCheck {
+	ba, err := DialBeanstalkAdmin(host)
+	if err != nil {
+		return &readyCheck{Detail: err.Error()}
+	}
+	defer ba.Close()
+
+	_, err = ba.StatsTube("default")
+	if err != nil {
+		return &readyCheck{Detail: err.Error()}
+	}
+
+	if waiting := beanstalkState.Waiting(); waiting > 0 {
+		return &readyCheck{Detail: fmt.Sprintf("%d workers reconnecting", waiting)}
+	}
+
+	tubes := strings.Join(config.SourceTubeNames(), ", ")
+	if workers == 0 {
+		return &readyCheck{Detail: "no workers watching " + tubes}
+	}
+	if watching := workerHealth.WatchingCount(); watching < workers {
+		return &readyCheck{Detail: fmt.Sprintf("%d of %d workers watching %s", watching, workers, tubes)}
+	}
+
+	return &readyCheck{OK: true, Detail: tubes}
+}
+
+func checkMySQL(db *sql.DB) *readyCheck {
+	if db == nil {
+		return &readyCheck{Detail: "not connected"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		return &readyCheck{Detail: err.Error()}
+	}
+
+	return &readyCheck{OK: true}
+}
+
+func checkTextRazor(provider, fallbackProvider string, keyed bool) *readyCheck {
+	if provider != ProviderTextRazor && fallbackProvider != ProviderTextRazor {
+		return &readyCheck{OK: true, Detail: "not used"}
+	}
+	if !keyed {
+		return &readyCheck{Detail: "no API key, see -key"}
+	}
+
+	return &readyCheck{OK: true}
+}
+
+// checkQuota fails once the quota is exhausted, unless TextRazor isn't
+// the provider or there is a fallback to use meanwhile
+func checkQuota(provider, fallbackProvider string) *readyCheck {
+	if quota == nil {
+		return &readyCheck{Detail: "not loaded"}
+	}
+
+	remaining := quota.Remaining()
+	return &readyCheck{
+		OK:     remaining > 0 || provider != ProviderTextRazor || fallbackProvider != "",
+		Detail: fmt.Sprintf("%d of %d remaining until %s", remaining, quota.Limit(), quota.ResetAt().Format(time.RFC3339)),
+	}
+}
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.Errorf("Admin response: %s", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Analysis is the provider neutral result of analysing an article.
+// Every ArticleAnalyser returns one, so the rest of the worker never
+// needs to know which provider did the work.
+type Analysis struct {
+	URL                string          `json:"url"`
+	Provider           string          `json:"provider"`
+	AnalysedAt         time.Time       `json:"analysedAt"`
+	Language           string          `json:"language"`
+	LanguageIsReliable bool            `json:"languageIsReliable"`
+	Topics             []Topic         `json:"topics"`
+	CoarseTopics       []Topic         `json:"coarseTopics"`
+	Entities           []Entity        `json:"entities"`
+	Sentences          []Sentence      `json:"sentences"`
+	Fetch              *FetchInfo      `json:"fetch,omitempty"` // set when nusetextd downloaded the article itself
+	Raw                json.RawMessage `json:"raw,omitempty"`   // the provider's response, archived verbatim
+}
+
+// Topic struct
+type Topic struct {
+	Label      string  `json:"label"`
+	Score      float64 `json:"score"`
+	WikiLink   string  `json:"wikiLink,omitempty"`
+	WikidataID string  `json:"wikidataId,omitempty"`
+}
+
+// Entity struct
+type Entity struct {
+	ID             string              `json:"id"`
+	EnglishID      string              `json:"englishId,omitempty"`
+	Types          []string            `json:"types,omitempty"`
+	FreebaseTypes  []string            `json:"freebaseTypes,omitempty"`
+	FreebaseID     string              `json:"freebaseId,omitempty"`
+	WikidataID     string              `json:"wikidataId,omitempty"`
+	WikiLink       string              `json:"wikiLink,omitempty"`
+	MatchedText    string              `json:"matchedText"`
+	MatchingTokens []int               `json:"matchingTokens,omitempty"`
+	Data           map[string][]string `json:"data,omitempty"`
+	Confidence     float64             `json:"confidence"`
+	Relevance      float64             `json:"relevance"`
+}
+
+// Sentence struct
+type Sentence struct {
+	Position int    `json:"position"`
+	Words    []Word `json:"words,omitempty"`
+}
+
+// Word struct
+type Word struct {
+	Position     int    `json:"position"`
+	StartingPos  int    `json:"startingPos"`
+	EndingPos    int    `json:"endingPos"`
+	Token        string `json:"token"`
+	Lemma        string `json:"lemma,omitempty"`
+	Stem         string `json:"stem,omitempty"`
+	PartOfSpeech string `json:"partOfSpeech,omitempty"`
+}
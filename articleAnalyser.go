@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,52 +13,171 @@ import (
 var ErrRequestLimitMet = errors.New("Request limit met")
 
 // ArticleAnalyser interface
+// Implemented by each analysis provider.
 type ArticleAnalyser interface {
-	Analyse(u *ArticleURL) *TextRazorResult
+	Analyse(u *ArticleURL) (*Analysis, error)
 }
 
-// Analyser struct
-type Analyser struct {
-	apiKey            string
-	downloadUserAgent string
+// providers maps each -provider name to its ArticleAnalyser constructor
+var providers = map[string]func(c *WorkerConfig) ArticleAnalyser{
+	ProviderTextRazor: func(c *WorkerConfig) ArticleAnalyser {
+		return NewTextRazorAnalyser(c.textRazorAPIKey, c.timeout, c.fetchLocally, c.profiles)
+	},
+	ProviderLocal: func(c *WorkerConfig) ArticleAnalyser {
+		return NewLocalAnalyser(downloadUserAgent, c.timeout, NewCorpus(c.db))
+	},
 }
 
-// NewAnalyser Analyser constructor
-func NewAnalyser(key string) *Analyser {
-	return &Analyser{
-		apiKey:            key,
-		downloadUserAgent: fmt.Sprintf("NuseAgent Article Downloader v1.0 (%s)", url.QueryEscape("http://nuseagent.com/")),
+// closer is implemented by ArticleAnalysers holding connections
+type closer interface {
+	Close()
+}
+
+// ProviderNames returns the sorted names of the available providers
+func ProviderNames() string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// NewArticleAnalyser returns the ArticleAnalyser for the configured
+// provider, behind a CachingAnalyser when a memcache host is set, and
+// backed by a FallbackAnalyser when a fallback provider is set. Fallback
+// results are deliberately never cached.
+func NewArticleAnalyser(c *WorkerConfig) (ArticleAnalyser, error) {
+	newProvider, ok := providers[c.provider]
+	if !ok {
+		return nil, fmt.Errorf("Unknown provider %q, expected one of %s", c.provider, ProviderNames())
+	}
+
+	aa := newProvider(c)
+	if c.memcachedbHost != "" {
+		aa = NewCachingAnalyser(aa, NewResultCache(c.memcachedbHost, time.Duration(c.cacheTTL)*time.Second, memcacheTimeout), c.provider, c.profiles)
+	}
+
+	if c.fallbackProvider != "" {
+		newFallback, ok := providers[c.fallbackProvider]
+		if !ok {
+			return nil, fmt.Errorf("Unknown fallback provider %q, expected one of %s", c.fallbackProvider, ProviderNames())
+		}
+		aa = NewFallbackAnalyser(aa, newFallback(c))
+	}
+
+	return aa, nil
+}
+
+// FallbackAnalyser hands articles to its fallback ArticleAnalyser when
+// the primary is unavailable, i.e. out of quota or unreachable
+type FallbackAnalyser struct {
+	primary  ArticleAnalyser
+	fallback ArticleAnalyser
+}
+
+// NewFallbackAnalyser FallbackAnalyser constructor
+func NewFallbackAnalyser(primary, fallback ArticleAnalyser) *FallbackAnalyser {
+	return &FallbackAnalyser{
+		primary:  primary,
+		fallback: fallback,
 	}
 }
 
 // Analyse method
-func (a *Analyser) Analyse(u *ArticleURL) (*TextRazorResult, error) {
-
-	if config.RequestLimitMet() {
-		return nil, ErrRequestLimitMet
-	}
-
-	c := NewTimeoutClient(time.Duration(config.timeout) * time.Second)
-
-	tr := NewTextRazorRequest(a.apiKey)
-	tr.DownloadUserAgent = a.downloadUserAgent
-	tr.URL = u.String()
-	tr.CleanupMode = ModeCleanHTML
-	tr.CleanupReturnCleaned = false
-	tr.CleanupReturnRaw = false
-	tr.SetExtractors(
-		ExtractorTopics,
-		ExtractorEntities,
-		ExtractorWords,
-		ExtractorPhrases,
-		ExtractorDependancyTrees,
-		ExtractorRelations,
-		ExtractorEntailments,
-		ExtractorSenses,
-	)
-
-	result, err := tr.Analysis(c)
-	config.IncRequestCount()
-
-	return result, err
+func (fa *FallbackAnalyser) Analyse(u *ArticleURL) (*Analysis, error) {
+	analysis, err := fa.primary.Analyse(u)
+	if err == nil || !isProviderUnavailable(err) {
+		return analysis, err
+	}
+
+	u.Log().Warnf("Provider unavailable (%s); falling back", err)
+	return fa.fallback.Analyse(u)
+}
+
+// Close method
+func (fa *FallbackAnalyser) Close() {
+	if c, ok := fa.primary.(closer); ok {
+		c.Close()
+	}
+	if c, ok := fa.fallback.(closer); ok {
+		c.Close()
+	}
+}
+
+// isProviderUnavailable reports whether err means the provider could not
+// be used at all, rather than that it failed on this article. Failures
+// to download the article itself are FetchErrors, and never count.
+func isProviderUnavailable(err error) bool {
+	if err == ErrRequestLimitMet {
+		return true
+	}
+
+	switch e := err.(type) {
+	case *TextRazorError:
+		return e.Retryable()
+	case *json.SyntaxError:
+		return true
+	}
+
+	return false
+}
+
+// CachingAnalyser looks articles up in a ResultCache before handing them
+// to its ArticleAnalyser, so re-queued or duplicate articles cost no
+// provider requests. Results are cached by provider and the extractor
+// profile the article resolves to, so an article analysed under one
+// profile is not served to a tube wanting another. Cache failures are
+// logged and treated as a miss.
+type CachingAnalyser struct {
+	analyser ArticleAnalyser
+	cache    *ResultCache
+	provider string
+	profiles *ExtractorProfiles
+}
+
+// NewCachingAnalyser CachingAnalyser constructor
+func NewCachingAnalyser(a ArticleAnalyser, rc *ResultCache, provider string, profiles *ExtractorProfiles) *CachingAnalyser {
+	return &CachingAnalyser{
+		analyser: a,
+		cache:    rc,
+		provider: provider,
+		profiles: profiles,
+	}
+}
+
+// Analyse method
+func (ca *CachingAnalyser) Analyse(u *ArticleURL) (*Analysis, error) {
+	variant := ca.provider + "/" + ca.profiles.ProfileName(u)
+
+	analysis, err := ca.cache.Get(u, variant)
+	switch {
+	case err == nil:
+		cacheRequests.Inc("hit")
+		u.Log().Debugf("Cache hit")
+		return analysis, nil
+	case err == ErrCacheMiss:
+		cacheRequests.Inc("miss")
+	default:
+		cacheRequests.Inc("error")
+		u.Log().Warnf("Cache get: %s", err)
+	}
+
+	analysis, err = ca.analyser.Analyse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ca.cache.Set(u, variant, analysis)
+	if err != nil {
+		u.Log().Warnf("Cache set: %s", err)
+	}
+
+	return analysis, nil
+}
+
+// Close method
+func (ca *CachingAnalyser) Close() {
+	ca.cache.Close()
 }
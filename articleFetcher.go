@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxArticleSize is the most of an article body that is read
+const maxArticleSize = 2 << 20
+
+// downloadUserAgent identifies nusetextd, or TextRazor on our behalf,
+// to the sites articles are downloaded from
+var downloadUserAgent = fmt.Sprintf("NuseAgent Article Downloader v1.0 (%s)", url.QueryEscape("http://nuseagent.com/"))
+
+// FetchError is returned when an article page could not be downloaded:
+// Err is set when there was no response or it could not be read, else
+// Status is the response's, which was not 200 OK. It is about the
+// article's site, never the analysis provider.
+type FetchError struct {
+	URL    string
+	Status int
+	Err    error
+}
+
+func (e *FetchError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Fetch %s: %s", e.URL, e.Err)
+	}
+	return fmt.Sprintf("Fetch %s: %d %s", e.URL, e.Status, http.StatusText(e.Status))
+}
+
+// Retryable reports whether the site may well answer if asked again
+// later: network failures, timeouts, 429 and 5xx responses
+func (e *FetchError) Retryable() bool {
+	return e.Err != nil || e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// CharsetError is returned for an article in a charset nusetextd cannot
+// decode to UTF-8
+type CharsetError struct {
+	URL     string
+	Charset string
+}
+
+func (e *CharsetError) Error() string {
+	return fmt.Sprintf("Fetch %s: unsupported charset %q", e.URL, e.Charset)
+}
+
+// FetchInfo describes how nusetextd downloaded an article
+type FetchInfo struct {
+	Status        int    `json:"status"`
+	FinalURL      string `json:"finalUrl"`
+	ContentLength int    `json:"contentLength"`
+}
+
+// FetchedArticle is an article page downloaded by nusetextd itself. Body
+// has been decoded to UTF-8.
+type FetchedArticle struct {
+	URL           string
+	Status        int
+	ContentLength int
+	Charset       string
+	Body          []byte
+}
+
+// FetchArticle downloads rawurl with client, following redirects. The
+// client's timeouts bound the whole download. It logs through log.
+func FetchArticle(client *http.Client, rawurl, userAgent string, log *Logger) (*FetchedArticle, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &FetchError{URL: rawurl, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &FetchError{URL: rawurl, Status: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxArticleSize))
+	if err != nil {
+		return nil, &FetchError{URL: rawurl, Status: resp.StatusCode, Err: err}
+	}
+
+	fa := &FetchedArticle{
+		URL:           resp.Request.URL.String(),
+		Status:        resp.StatusCode,
+		ContentLength: len(body),
+	}
+	fa.Body, fa.Charset = decodeCharset(body, resp.Header.Get("Content-Type"), log)
+	if fa.Body == nil {
+		return nil, &CharsetError{URL: rawurl, Charset: fa.Charset}
+	}
+
+	return fa, nil
+}
+
+// Info method
+func (fa *FetchedArticle) Info() *FetchInfo {
+	return &FetchInfo{
+		Status:        fa.Status,
+		FinalURL:      fa.URL,
+		ContentLength: fa.ContentLength,
+	}
+}
+
+var (
+	reInvisible   = regexp.MustCompile(`(?is)<(script|style|noscript|head|template)\b.*?</(script|style|noscript|head|template)>`)
+	reComment     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	reBlockTag    = regexp.MustCompile(`(?i)</?(p|div|br|li|h[1-6]|tr|td|article|section|blockquote)\b[^>]*>`)
+	reLink        = regexp.MustCompile(`(?is)<a\b[^>]*>(.*?)</a>`)
+	reTag         = regexp.MustCompile(`(?s)<[^>]*>`)
+	reSpace       = regexp.MustCompile(`[ \t\r\f\v]+`)
+	reBlankLines  = regexp.MustCompile(`\n\s*\n+`)
+	reMetaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([\w-]+)`)
+)
+
+// Text returns the visible text of the article page, one block per line
+func (fa *FetchedArticle) Text() string {
+	var lines []string
+	for _, b := range fa.blocks() {
+		lines = append(lines, b.text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MainText returns the article text with boilerplate (navigation, link
+// lists, footers and the like) removed, or all the visible text if no
+// block looks like article content
+func (fa *FetchedArticle) MainText() string {
+	blocks := fa.blocks()
+	main := removeBoilerplate(blocks)
+	if len(main) == 0 {
+		return fa.Text()
+	}
+
+	lines := make([]string, len(main))
+	for i, b := range main {
+		lines[i] = b.text
+	}
+	return strings.Join(lines, "\n")
+}
+
+// blocks splits the page into its non empty block level elements
+func (fa *FetchedArticle) blocks() []textBlock {
+	s := string(fa.Body)
+	s = reInvisible.ReplaceAllString(s, " ")
+	s = reComment.ReplaceAllString(s, " ")
+
+	var blocks []textBlock
+	for _, h := range reBlockTag.Split(s, -1) {
+		text := cleanText(h)
+		if text == "" {
+			continue
+		}
+
+		linkText := 0
+		for _, m := range reLink.FindAllStringSubmatch(h, -1) {
+			linkText += len(cleanText(m[1]))
+		}
+
+		blocks = append(blocks, textBlock{
+			text:        text,
+			linkDensity: float64(linkText) / float64(len(text)),
+		})
+	}
+
+	return blocks
+}
+
+// cleanText strips tags and entities from an HTML fragment
+func cleanText(h string) string {
+	s := reTag.ReplaceAllString(h, " ")
+	s = html.UnescapeString(s)
+	s = reSpace.ReplaceAllString(s, " ")
+	s = reBlankLines.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(s)
+}
+
+// decodeCharset converts body to UTF-8 from the charset in the
+// Content-Type header or a <meta> tag. Undeclared bodies that are not
+// valid UTF-8 are assumed to be Windows-1252, as browsers do. The body
+// is nil if its charset is unsupported and it is not valid UTF-8 anyway.
+func decodeCharset(body []byte, contentType string, log *Logger) ([]byte, string) {
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = strings.ToLower(params["charset"])
+	}
+	if charset == "" {
+		head := body
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if m := reMetaCharset.FindSubmatch(head); m != nil {
+			charset = strings.ToLower(string(m[1]))
+		}
+	}
+
+	switch charset {
+	case "utf-8", "utf8":
+		return body, charset
+	case "iso-8859-1", "iso-8859-15", "latin1", "windows-1252", "cp1252", "us-ascii", "ascii":
+		return decodeWindows1252(body), charset
+	case "":
+		if utf8.Valid(body) {
+			return body, "utf-8"
+		}
+		return decodeWindows1252(body), "windows-1252"
+	}
+
+	if !utf8.Valid(body) {
+		return nil, charset
+	}
+	log.Infof("Unsupported charset %q, but valid UTF-8", charset)
+	return body, charset
+}
+
+// windows1252 maps the 0x80-0x9F range of Windows-1252, where it differs
+// from ISO-8859-1
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+// decodeWindows1252 converts Windows-1252, and so ISO-8859-1, to UTF-8
+func decodeWindows1252(b []byte) []byte {
+	var buf bytes.Buffer
+	for _, c := range b {
+		switch {
+		case c < 0x80:
+			buf.WriteByte(c)
+		case c < 0xA0:
+			buf.WriteRune(windows1252[c-0x80])
+		default:
+			buf.WriteRune(rune(c))
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDecodeWindows1252(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte("plain ASCII"), "plain ASCII"},
+		{[]byte{'5', 0x80}, "5€"},
+		{[]byte{0x93, 'q', 0x94, ' ', 0x85}, "“q” …"},
+		{[]byte{'c', 'a', 'f', 0xE9}, "café"},
+		{[]byte{0xA0, 0xFF}, " ÿ"},
+		{[]byte{0x81, 0x8D}, "\u0081\u008d"}, // undefined in Windows-1252
+	}
+
+	for _, test := range tests {
+		if got := string(decodeWindows1252(test.in)); got != test.want {
+			t.Errorf("decodeWindows1252(% x) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	latin1 := []byte{'c', 'a', 'f', 0xE9}
+
+	tests := []struct {
+		body        []byte
+		contentType string
+		want        string
+		charset     string
+	}{
+		{[]byte("café"), "text/html; charset=UTF-8", "café", "utf-8"},
+		{latin1, "text/html; charset=ISO-8859-1", "café", "iso-8859-1"},
+		{latin1, "text/html; charset=windows-1252", "café", "windows-1252"},
+		{[]byte("café"), "text/html", "café", "utf-8"},
+		{latin1, "", "café", "windows-1252"},
+		{append([]byte(`<html><head><meta charset="latin1">`), latin1...), "text/html", `<html><head><meta charset="latin1">café`, "latin1"},
+		{append([]byte(`<meta http-equiv="Content-Type" content="text/html; charset=utf-8">`), "café"...), "", `<meta http-equiv="Content-Type" content="text/html; charset=utf-8">café`, "utf-8"},
+		// the header wins over the <meta> tag
+		{append([]byte(`<meta charset="utf-8">`), latin1...), "text/html; charset=iso-8859-1", `<meta charset="utf-8">café`, "iso-8859-1"},
+		// unsupported, but valid UTF-8 anyway
+		{[]byte("plain"), "text/html; charset=Shift_JIS", "plain", "shift_jis"},
+	}
+
+	for _, test := range tests {
+		got, charset := decodeCharset(test.body, test.contentType, logger)
+		if string(got) != test.want || charset != test.charset {
+			t.Errorf("decodeCharset(%q, %q) = %q %q, want %q %q", test.body, test.contentType, got, charset, test.want, test.charset)
+		}
+	}
+
+	got, charset := decodeCharset([]byte{0x82, 0xA0}, "text/html; charset=Shift_JIS", logger)
+	if got != nil || charset != "shift_jis" {
+		t.Errorf("decodeCharset of undecodable Shift_JIS = %q %q, want nil shift_jis", got, charset)
+	}
+}
+
+func TestFetchArticle(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			if r.UserAgent() != "nusetextd-test" {
+				http.Error(w, "no user agent", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			w.Write([]byte{'c', 'a', 'f', 0xE9})
+		case "/moved":
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+		case "/sjis":
+			w.Header().Set("Content-Type", "text/html; charset=Shift_JIS")
+			w.Write([]byte{0x82, 0xA0})
+		case "/busy":
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	fa, err := FetchArticle(client, ts.URL+"/moved", "nusetextd-test", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fa.Body) != "café" || fa.Charset != "iso-8859-1" || fa.URL != ts.URL+"/article" || fa.Status != 200 || fa.ContentLength != 4 {
+		t.Errorf("FetchArticle = %+v", fa)
+	}
+
+	_, err = FetchArticle(client, ts.URL+"/sjis", "nusetextd-test", logger)
+	if ce, ok := err.(*CharsetError); !ok || ce.Charset != "shift_jis" {
+		t.Errorf("FetchArticle of Shift_JIS: %v (%T), want a CharsetError", err, err)
+	}
+
+	tests := []struct {
+		path      string
+		status    int
+		retryable bool
+	}{
+		{"/busy", http.StatusServiceUnavailable, true},
+		{"/gone", http.StatusNotFound, false},
+	}
+	for _, test := range tests {
+		_, err = FetchArticle(client, ts.URL+test.path, "nusetextd-test", logger)
+		fe, ok := err.(*FetchError)
+		if !ok || fe.Status != test.status || fe.Retryable() != test.retryable {
+			t.Errorf("FetchArticle of %s: %v (%T), want a FetchError %d retryable %v", test.path, err, err, test.status, test.retryable)
+		}
+	}
+
+	ts.Close()
+	_, err = FetchArticle(client, ts.URL+"/article", "nusetextd-test", logger)
+	if fe, ok := err.(*FetchError); !ok || fe.Err == nil || !fe.Retryable() {
+		t.Errorf("FetchArticle from a closed server: %v (%T), want a retryable FetchError", err, err)
+	}
+}
+
+func TestFetchErrorRetryable(t *testing.T) {
+	tests := []struct {
+		err  *FetchError
+		want bool
+	}{
+		{&FetchError{Err: fmt.Errorf("connection refused")}, true},
+		{&FetchError{Status: http.StatusTooManyRequests}, true},
+		{&FetchError{Status: http.StatusBadGateway}, true},
+		{&FetchError{Status: http.StatusNotFound}, false},
+		{&FetchError{Status: http.StatusForbidden}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.err.Retryable(); got != test.want {
+			t.Errorf("%s: Retryable() = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
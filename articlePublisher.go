@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// publishTopicCount is the number of top scoring topics included in
+// a published ArticleSummary
+const publishTopicCount = 5
+
+// ArticleSummary is the job body put into the destination tube
+type ArticleSummary struct {
+	URL         string   `json:"url"`
+	Hash        string   `json:"hash"` // articles.hash of the stored analysis
+	Provider    string   `json:"provider"`
+	Language    string   `json:"language"`
+	Topics      []string `json:"topics"`
+	EntityCount int      `json:"entityCount"`
+	FeedID      int64    `json:"feedId,omitempty"`
+	TraceID     string   `json:"traceId,omitempty"`
+}
+
+// NewArticleSummary ArticleSummary constructor
+func NewArticleSummary(au *ArticleURL, a *Analysis) *ArticleSummary {
+	topics := make([]Topic, len(a.Topics))
+	copy(topics, a.Topics)
+	sort.SliceStable(topics, func(i, j int) bool {
+		return topics[i].Score > topics[j].Score
+	})
+	if len(topics) > publishTopicCount {
+		topics = topics[:publishTopicCount]
+	}
+
+	labels := make([]string, len(topics))
+	for i, t := range topics {
+		labels[i] = t.Label
+	}
+
+	return &ArticleSummary{
+		URL:         au.String(),
+		Hash:        generateHash(a.URL),
+		Provider:    a.Provider,
+		Language:    a.Language,
+		Topics:      labels,
+		EntityCount: len(a.Entities),
+		FeedID:      au.Meta.FeedID,
+		TraceID:     au.Meta.TraceID,
+	}
+}
+
+// ArticlePublisher puts analysed articles into the destination tube
+type ArticlePublisher struct {
+	bsConn   *BeanstalkConn
+	destTube string
+	ttr      time.Duration
+}
+
+// NewArticlePublisher constructor for ArticlePublisher
+func NewArticlePublisher(bs *BeanstalkConn, destTube string, ttr int) *ArticlePublisher {
+	return &ArticlePublisher{
+		bsConn:   bs,
+		destTube: destTube,
+		ttr:      time.Duration(ttr) * time.Second,
+	}
+}
+
+// Publish method
+func (ap *ArticlePublisher) Publish(au *ArticleURL, a *Analysis) error {
+	body, err := json.Marshal(NewArticleSummary(au, a))
+	if err != nil {
+		return err
+	}
+
+	// The connection is shared with the ArticleSupplier, which may
+	// have switched tubes, so always Use the dest tube before a Put
+	err = ap.bsConn.Use(ap.destTube)
+	if err != nil {
+		return err
+	}
+
+	id, err := ap.bsConn.Put(body, au.Priority(), 0, ap.ttr)
+	if err != nil {
+		return err
+	}
+	au.Log().Debugf("Published to %s as job %d", ap.destTube, id)
+
+	return nil
+}
@@ -1,106 +1,272 @@
 package main
 
 import (
+	"math/rand"
+	"time"
+
 	beanstalk "github.com/JalfResi/gobeanstalk"
 	"gopkg.in/yaml.v2"
 )
 
+// reserveTimeout is how long, in seconds, a reserve blocks before
+// the supplier checks whether it has been asked to stop
+const reserveTimeout = 1
+
+// unknownPriority is the priority a job is released with when its own
+// could not be read; beanstalkd clients commonly put jobs with it
+const unknownPriority = 1024
+
+// Retry backoff: the delay doubles with each failed attempt, from
+// retryBaseDelay up to retryMaxDelay
+const (
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 6 * time.Hour
+)
+
 // ArticleURLSupplier interface
 type ArticleURLSupplier interface {
-	GetArticleURL() *ArticleURL
+	GetArticleURL(quit <-chan struct{}) *ArticleURL
 	Done(fu *ArticleURL)
 }
 
 // ArticleSupplier struct
 type ArticleSupplier struct {
-	bsConn *beanstalk.Conn
-	minTTR int
+	bsConn     *BeanstalkConn
+	schedule   *TubeSchedule
+	maxRetries uint64
+	failures   *FailureLog
+	log        *Logger
 }
 
 // NewArticleSupplier constructor for ArticleSupplier
-func NewArticleSupplier(bs *beanstalk.Conn, minTTR int, srcTube string) *ArticleSupplier {
-	fs := &ArticleSupplier{
-		bsConn: bs,
-		minTTR: minTTR,
+// The ArticleURLs supplied log through log.
+func NewArticleSupplier(bs *BeanstalkConn, maxRetries uint64, failures *FailureLog, schedule *TubeSchedule, log *Logger) *ArticleSupplier {
+	return &ArticleSupplier{
+		bsConn:     bs,
+		schedule:   schedule,
+		maxRetries: maxRetries,
+		failures:   failures,
+		log:        log,
 	}
-	fs.SetSrcTube(srcTube)
+}
 
-	return fs
+// Done method
+func (as *ArticleSupplier) Done(au *ArticleURL) {
+	if as.bsConn.Delete(au.job.ID) != nil {
+		return
+	}
+	jobsTotal.Inc("deleted")
+
+	// Only a job released before can have failed attempts recorded
+	if au.stats.Releases > 0 {
+		err := as.failures.Forget(au.job.ID)
+		if err != nil {
+			au.Log().Errorf("Failures not forgotten: %s", err)
+		}
+	}
 }
 
-// SetSrcTube method
-func (as *ArticleSupplier) SetSrcTube(srcTube string) {
-	// Watch our source tube or bail
-	_, err := as.bsConn.Watch(srcTube)
-	if err != nil {
-		logError.Fatalf("Could not watch tube %s: %v\n", srcTube, err)
+// Retry method
+// Releases the job to be tried again after an exponentially increasing,
+// jittered delay, or buries it once it has failed maxRetries times.
+// Failures are counted in the FailureLog, as beanstalkd's release count
+// also includes backlog and shutdown releases. err is the failure being
+// retried.
+func (as *ArticleSupplier) Retry(au *ArticleURL, err error) {
+	attempts, ferr := as.failures.Attempt(au.job.ID, au.stats.Tube, err)
+	if ferr != nil {
+		// Counting every release may bury the job early, but never
+		// retries it forever
+		au.Log().Errorf("Failure not counted; counting releases instead: %s", ferr)
+		attempts = au.stats.Releases + 1
 	}
+
+	if uint64(attempts) >= as.maxRetries {
+		as.Bury(au, err)
+		au.Log().Errorf("Giving up after %d attempts; burying: %s", attempts, err)
+		return
+	}
+
+	delay := retryDelay(attempts - 1)
+	as.release(au.job.ID, au.Priority(), delay)
+	au.Log().Warnf("Attempt %d failed; retrying in %s: %s", attempts, delay, err)
 }
 
-// Done method
-func (as *ArticleSupplier) Done(au *ArticleURL) {
-	_ = as.bsConn.Delete(au.job.ID)
+// Defer method
+// Releases the job with a new priority, ready again after delay.
+func (as *ArticleSupplier) Defer(au *ArticleURL, pri uint32, delay time.Duration) {
+	as.release(au.job.ID, pri, delay)
 }
 
-// Retry method
-func (as *ArticleSupplier) Retry(au *ArticleURL) {
-	_ = as.bsConn.Release(au.job.ID, 1, 0)
+// release releases the job, ready again after delay
+func (as *ArticleSupplier) release(id uint64, pri uint32, delay time.Duration) {
+	if as.bsConn.Release(id, pri, delay) == nil {
+		jobsTotal.Inc("released")
+	}
+}
+
+// Bury method
+// Records reason in the FailureLog for the buried command.
+func (as *ArticleSupplier) Bury(au *ArticleURL, reason error) {
+	as.bury(au.job.ID, au.stats, reason, au.Log())
+}
+
+// bury buries the job with its current priority and records reason
+func (as *ArticleSupplier) bury(id uint64, stats *StatsJob, reason error, log *Logger) {
+	err := as.bsConn.Bury(id, uint32(stats.Pri))
+	if err != nil {
+		log.Errorf("Bury failed: %s", err)
+		return
+	}
+	jobsTotal.Inc("buried")
+
+	err = as.failures.Record(id, stats.Tube, reason)
+	if err != nil {
+		log.Errorf("Failure not recorded: %s", err)
+	}
+}
+
+// Close method
+func (as *ArticleSupplier) Close() {
+	if as.bsConn.Conn != nil {
+		as.bsConn.Quit()
+	}
 }
 
 // GetArticleURL method
-func (as *ArticleSupplier) GetArticleURL() *ArticleURL {
+// Blocks until a job is reserved or quit is closed, in which case nil
+// is returned. A job reserved just as quit closes is released straight
+// back to the tube with its own priority. A broken connection is re-established meanwhile.
+func (as *ArticleSupplier) GetArticleURL(quit <-chan struct{}) *ArticleURL {
 	for {
-		job, err := as.bsConn.Reserve()
+		// Waiting for a job is progress as far as /healthz is concerned
+		workerHealth.Beat(quit)
+
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+
+		job, err := as.reserve()
 		if err != nil {
-			logError.Fatal(err)
+			switch err.Error() {
+			case "timed out", "deadline soon":
+				workerHealth.Watching(quit, true)
+				continue
+			}
+
+			// Anything else may have left the connection out of step
+			// with beanstalkd, so start afresh
+			workerHealth.Watching(quit, false)
+			if !as.bsConn.Reconnect(quit, err) {
+				return nil
+			}
+			continue
 		}
+		workerHealth.Watching(quit, true)
+		jobsTotal.Inc("reserved")
 
-		// First we check the TTR of the job
-		// if it is lower than *timeout, we
-		// put it back in the tube with an
-		// increased TTR. This ensures that
-		// all jobs we deal with can be dealt
-		// within a sensible timeframe, otherwise
-		// the job will keep failing and will be
-		// automatically reclaimed by beanstalk
-		stats := as.getJobTTR(job)
-		if stats.TTR < as.minTTR {
-			as.increaseJobTTR(job, stats, as.minTTR)
-			logError.Printf("Increased job %d TTR to %d from %d\n", job.ID, as.minTTR, stats.TTR)
+		// The job's TTR may well be shorter than the analysis takes;
+		// the worker keeps the reservation alive with a Heartbeat
+		stats, err := as.getJobTTR(job)
+		if err != nil {
+			// A broken connection releases the job itself
+			if isConnError(err) {
+				workerHealth.Watching(quit, false)
+				if !as.bsConn.Reconnect(quit, err) {
+					return nil
+				}
+				continue
+			}
+			as.log.With("job", job.ID, "stage", StageReserve).Errorf("Job stats: %s; releasing", err)
+			as.release(job.ID, unknownPriority, 0)
 			continue
 		}
 
+		select {
+		case <-quit:
+			as.release(job.ID, uint32(stats.Pri), 0)
+			return nil
+		default:
+		}
+
+		tubeStats.Reserved(stats.Tube)
+		log := as.log.With("job", job.ID, "tube", stats.Tube)
 		au, err := NewArticleURL(job, stats)
 		if err != nil {
-			_ = as.bsConn.Bury(job.ID, 1)
-			logError.Printf("Bad Article URL format; burying: %s\n", err)
+			tubeStats.Failed(stats.Tube)
+			log = log.With("stage", StageReserve)
+			as.bury(job.ID, stats, err, log)
+			log.Errorf("Bad Article URL format; burying: %s", err)
 			continue
 		}
-		logInfo.Printf("Article URL: %s\n", au)
+
+		au.log = log.With("hash", au.Hash, "url", au.String())
+		if au.Meta.TraceID != "" {
+			au.log = au.log.With("trace", au.Meta.TraceID)
+		}
+		au.SetStage(StageReserve)
+		au.Log().Debugf("Reserved article")
 		return au
 	}
 }
 
+// reserve reserves a job from the source tubes. With more than one, each
+// is tried in the TubeSchedule's order without waiting, and only if all
+// are empty does the supplier wait on them all at once.
+func (as *ArticleSupplier) reserve() (*beanstalk.Job, error) {
+	tubes := as.schedule.Order()
+	if len(tubes) > 1 {
+		for _, tube := range tubes {
+			err := as.bsConn.WatchOnly(tube)
+			if err != nil {
+				return nil, err
+			}
+
+			job, err := as.bsConn.ReserveWithTimeout(0)
+			if err == nil || err.Error() != "timed out" {
+				return job, err
+			}
+		}
+	}
+
+	err := as.bsConn.WatchOnly(tubes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return as.bsConn.ReserveWithTimeout(reserveTimeout)
+}
+
 // getJobTTR method
-func (as *ArticleSupplier) getJobTTR(job *beanstalk.Job) *StatsJob {
+func (as *ArticleSupplier) getJobTTR(job *beanstalk.Job) (*StatsJob, error) {
 	rawJobStats, err := as.bsConn.StatsJob(job.ID)
 	if err != nil {
-		logError.Fatalf("Job %d StatsJob failed: %s\n", job.ID, err)
+		return nil, err
 	}
 
 	statsJob := StatsJob{}
 	err = yaml.Unmarshal(rawJobStats, &statsJob)
 	if err != nil {
-		logError.Fatalf("Job %d yaml: %s\n", job.ID, err)
+		return nil, err
 	}
 
-	return &statsJob
+	return &statsJob, nil
 }
 
-// NOTE:
-// Uses globals! Naughty!
-func (as *ArticleSupplier) increaseJobTTR(job *beanstalk.Job, stats *StatsJob, newTTR int) {
-	_ = as.bsConn.Use(config.srcTube)
-	_, _ = as.bsConn.PutUnique(job.Body, stats.Pri, 1, newTTR) // We can set the delay to 1 because the delay is already up and will be reset when we crawl the feed
-	_ = as.bsConn.Delete(job.ID)
+// retryDelay returns the delay before retrying a job that has failed n
+// times before, between half and all of retryBaseDelay * 2^n so that articles
+// failing together do not all come back together
+func retryDelay(n int) time.Duration {
+	if n < 0 {
+		n = 0
+	}
+
+	delay := retryMaxDelay
+	if n < 32 && retryBaseDelay<<uint(n) < retryMaxDelay {
+		delay = retryBaseDelay << uint(n)
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
 }
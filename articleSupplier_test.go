@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration // the unjittered delay
+	}{
+		{-1, retryBaseDelay},
+		{0, retryBaseDelay},
+		{1, 2 * retryBaseDelay},
+		{3, 8 * retryBaseDelay},
+		{9, 512 * retryBaseDelay}, // over 4 hours
+		{10, retryMaxDelay},
+		{40, retryMaxDelay},
+		{1000, retryMaxDelay},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			d := retryDelay(test.n)
+			if d < test.want/2 || d >= test.want {
+				t.Errorf("retryDelay(%d) = %s, want from %s to %s", test.n, d, test.want/2, test.want)
+				break
+			}
+		}
+	}
+}
@@ -1,23 +1,64 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"time"
 
 	beanstalk "github.com/JalfResi/gobeanstalk"
 )
 
+// ArticleJob is the JSON envelope a feeder may put in the source tube
+// instead of a bare URL, e.g.
+//
+//	{"url": "http://example.com/a", "feedId": 12, "feedTitle": "Example",
+//	 "published": "2017-06-01T09:30:00Z", "languageHint": "eng",
+//	 "priority": 512, "profile": "topics-only", "traceId": "f3a9"}
+//
+// Only url is required.
+type ArticleJob struct {
+	URL          string     `json:"url"`
+	FeedID       int64      `json:"feedId,omitempty"`
+	FeedTitle    string     `json:"feedTitle,omitempty"`
+	Published    *time.Time `json:"published,omitempty"`
+	LanguageHint string     `json:"languageHint,omitempty"` // ISO 639-2, as TextRazor's languageOverride
+	Priority     *uint32    `json:"priority,omitempty"`     // overrides the job priority when nusetextd puts the article back
+	Profile      string     `json:"profile,omitempty"`      // overrides the extractor profile of the source tube
+	TraceID      string     `json:"traceId,omitempty"`
+}
+
 // ArticleURL struct
 type ArticleURL struct {
 	url   *url.URL
 	Hash  string
+	Meta  *ArticleJob
 	job   *beanstalk.Job
 	stats *StatsJob
+	log   *Logger
+	stage string
 }
 
 // NewArticleURL ArticleURL constructor
+// The job body is either a bare URL or an ArticleJob.
 func NewArticleURL(job *beanstalk.Job, stats *StatsJob) (*ArticleURL, error) {
-	u, parseErr := url.Parse(string(job.Body))
+	meta := &ArticleJob{}
+	body := bytes.TrimSpace(job.Body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		err := json.Unmarshal(body, meta)
+		if err != nil {
+			return nil, err
+		}
+		if meta.URL == "" {
+			return nil, errors.New("Article job has no url")
+		}
+	} else {
+		meta.URL = string(job.Body)
+	}
+
+	u, parseErr := url.Parse(meta.URL)
 	if parseErr != nil {
 		return nil, parseErr
 	}
@@ -25,11 +66,33 @@ func NewArticleURL(job *beanstalk.Job, stats *StatsJob) (*ArticleURL, error) {
 	return &ArticleURL{
 		url:   u,
 		Hash:  fmt.Sprintf("%32s_article", generateHash(u.String())),
+		Meta:  meta,
 		job:   job,
 		stats: stats,
+		log:   logger,
 	}, nil
 }
 
 func (a *ArticleURL) String() string {
 	return a.url.String()
 }
+
+// Priority returns the priority the article is put back in a tube with
+func (a *ArticleURL) Priority() uint32 {
+	if a.Meta.Priority != nil {
+		return *a.Meta.Priority
+	}
+	return uint32(a.stats.Pri)
+}
+
+// Log returns a Logger adding the article's current stage to the lines
+// of the Logger it was reserved with
+func (a *ArticleURL) Log() *Logger {
+	return a.log.With("stage", a.stage)
+}
+
+// SetStage method
+// Sets the worker loop stage the article is in, for its log lines.
+func (a *ArticleURL) SetStage(stage string) {
+	a.stage = stage
+}
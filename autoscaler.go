@@ -0,0 +1,129 @@
+package main
+
+import (
+	"time"
+)
+
+// Autoscaler grows and shrinks a Stack from the number of ready jobs
+// in the source tubes
+type Autoscaler struct {
+	stack         *Stack
+	host          string
+	tubes         []string
+	min           int
+	max           int
+	jobsPerWorker int
+	interval      time.Duration
+	cooldown      time.Duration
+	lastScaled    time.Time
+	admin         *BeanstalkAdmin
+	quotaBound    bool
+}
+
+// NewAutoscaler Autoscaler constructor
+func NewAutoscaler(stack *Stack, c *NusefeedConfig) *Autoscaler {
+	c.Lock()
+	defer c.Unlock()
+
+	jobsPerWorker := c.autoscaleJobsPerWorker
+	if jobsPerWorker < 1 {
+		jobsPerWorker = 1
+	}
+
+	return &Autoscaler{
+		stack:         stack,
+		host:          c.beanstalkdHost,
+		tubes:         sourceTubeNames(c.srcTubes),
+		min:           c.autoscaleMin,
+		max:           c.autoscaleMax,
+		jobsPerWorker: jobsPerWorker,
+		interval:      time.Duration(c.autoscaleInterval) * time.Second,
+		cooldown:      time.Duration(c.autoscaleCooldown) * time.Second,
+		quotaBound:    c.provider == ProviderTextRazor && c.fallbackProvider == "",
+	}
+}
+
+// Run checks the tube every interval until the stack is closed
+func (a *Autoscaler) Run() {
+	for {
+		time.Sleep(a.interval)
+
+		err := a.scale()
+		if err == ErrStackClosed {
+			return
+		}
+		if err != nil {
+			logger.Errorf("Autoscale: %s", err)
+		}
+	}
+}
+
+// scale resizes the stack towards the target for the current tube
+// depth, unless the last resize was within the cooldown
+func (a *Autoscaler) scale() error {
+	if a.admin == nil {
+		admin, err := DialBeanstalkAdmin(a.host)
+		if err != nil {
+			return err
+		}
+		a.admin = admin
+	}
+
+	// A tube nothing has been put in yet does not exist
+	ready := 0
+	for _, tube := range a.tubes {
+		stats, err := a.admin.StatsTube(tube)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			// Drop the connection so the next check redials
+			a.admin.Close()
+			a.admin = nil
+			return err
+		}
+		ready += stats.CurrentJobsReady
+	}
+
+	// Without TextRazor there is no quota, and with a fallback workers
+	// carry on once it is spent
+	remaining := a.max
+	if a.quotaBound {
+		remaining = quota.Remaining()
+	}
+
+	current := a.stack.Len()
+	target := a.target(ready, remaining)
+	if target == current || time.Since(a.lastScaled) < a.cooldown {
+		return nil
+	}
+
+	err := a.stack.Resize(target, func() *WorkerConfig { return newWorkerConfig(config) })
+	if err != nil {
+		return err
+	}
+	a.lastScaled = time.Now()
+	logger.Infof("Autoscaled workers from %d to %d for %d ready jobs", current, target, ready)
+
+	return nil
+}
+
+// target is the worker count for ready jobs, kept within min and max.
+// When TextRazor is the only provider there is no point running more
+// workers than there are requests left today, so remaining caps the
+// target, even below min.
+func (a *Autoscaler) target(ready, remaining int) int {
+	target := (ready + a.jobsPerWorker - 1) / a.jobsPerWorker
+
+	if target < a.min {
+		target = a.min
+	}
+	if target > a.max {
+		target = a.max
+	}
+	if target > remaining {
+		target = remaining
+	}
+
+	return target
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// backlog policy constants
+const (
+	BacklogReady string = "ready" // release and sleep until the quota resets
+	BacklogDelay string = "delay" // release with a delay until the quota resets
+	BacklogBury  string = "bury"  // bury jobs older than the max age, delay the rest
+	BacklogSkip  string = "skip"  // delete jobs older than the max age to the skipped log, delay the rest
+)
+
+// BacklogPolicy decides what happens to an article reserved while the
+// daily TextRazor quota is exhausted. Whatever the policy, articles put
+// back in the tube have their priority lowered by the penalty, so when
+// the quota resets fresh articles are analysed before the leftovers.
+type BacklogPolicy struct {
+	policy  string
+	maxAge  time.Duration
+	penalty uint32
+}
+
+// NewBacklogPolicy BacklogPolicy constructor
+func NewBacklogPolicy(policy string, maxAgeHours int, penalty uint) (*BacklogPolicy, error) {
+	switch policy {
+	case BacklogReady, BacklogDelay, BacklogBury, BacklogSkip:
+	default:
+		return nil, fmt.Errorf("Unknown backlog policy %q", policy)
+	}
+
+	if penalty > math.MaxUint32 {
+		penalty = math.MaxUint32
+	}
+
+	return &BacklogPolicy{
+		policy:  policy,
+		maxAge:  time.Duration(maxAgeHours) * time.Hour,
+		penalty: uint32(penalty),
+	}, nil
+}
+
+// Apply deals with au until the quota resets at resetAt. It returns true
+// if the worker should sleep until then rather than carry on reserving.
+func (bp *BacklogPolicy) Apply(as *ArticleSupplier, au *ArticleURL, resetAt time.Time) bool {
+	pri := bp.priority(au)
+	age := time.Duration(au.stats.Age) * time.Second
+
+	switch {
+	case bp.policy == BacklogReady:
+		as.Defer(au, pri, 0)
+		return true
+	case bp.policy == BacklogBury && age > bp.maxAge:
+		as.Bury(au, ErrRequestLimitMet)
+		au.Log().Warnf("Quota exhausted; buried, %s old", age)
+	case bp.policy == BacklogSkip && age > bp.maxAge:
+		as.Done(au)
+		logSkipped.With("job", au.job.ID, "url", au.String(), "age", age).Infof("%s", ErrRequestLimitMet)
+	default:
+		as.Defer(au, pri, time.Until(resetAt))
+	}
+
+	return false
+}
+
+// priority is the article's priority lowered by the penalty, saturating
+// at the least urgent priority
+func (bp *BacklogPolicy) priority(au *ArticleURL) uint32 {
+	pri := uint64(au.Priority()) + uint64(bp.penalty)
+	if pri > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(pri)
+}
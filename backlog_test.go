@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBacklogPolicyPriority(t *testing.T) {
+	override := uint32(10)
+
+	tests := []struct {
+		penalty  uint
+		jobPri   int
+		override *uint32
+		want     uint32
+	}{
+		{0, 1024, nil, 1024},
+		{100, 1024, nil, 1124},
+		{100, 1024, &override, 110},
+		{100, math.MaxUint32 - 50, nil, math.MaxUint32},
+		{math.MaxUint32, 5, nil, math.MaxUint32},
+	}
+
+	for _, test := range tests {
+		bp, err := NewBacklogPolicy(BacklogDelay, 24, test.penalty)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		au := &ArticleURL{
+			Meta:  &ArticleJob{URL: "http://example.com/", Priority: test.override},
+			stats: &StatsJob{Pri: test.jobPri},
+		}
+		if got := bp.priority(au); got != test.want {
+			t.Errorf("penalty %d, priority %d (override %v): got %d, want %d", test.penalty, test.jobPri, test.override, got, test.want)
+		}
+	}
+}
+
+func TestNewBacklogPolicyUnknown(t *testing.T) {
+	if _, err := NewBacklogPolicy("drop", 24, 0); err == nil {
+		t.Error("no error for an unknown policy")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNotFound is returned for a job or tube that does not exist, or a
+// job not in the state the command needs
+var ErrNotFound = errors.New("not found")
+
+// BeanstalkAdmin is a minimal beanstalkd client for the inspection
+// commands the vendored gobeanstalk lacks or gets wrong (its StatsTube
+// takes a numeric id rather than a tube name, and it has no peek or
+// kick).
+type BeanstalkAdmin struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// DialBeanstalkAdmin BeanstalkAdmin constructor
+func DialBeanstalkAdmin(addr string) (*BeanstalkAdmin, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BeanstalkAdmin{
+		conn: conn,
+		rd:   bufio.NewReader(conn),
+	}, nil
+}
+
+// StatsTube method
+func (ba *BeanstalkAdmin) StatsTube(tube string) (*StatsTube, error) {
+	body, err := ba.sendGetBody(fmt.Sprintf("stats-tube %s\r\n", tube))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := StatsTube{}
+	err = yaml.Unmarshal(body, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// StatsJob method
+func (ba *BeanstalkAdmin) StatsJob(id uint64) (*StatsJob, error) {
+	body, err := ba.sendGetBody(fmt.Sprintf("stats-job %d\r\n", id))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := StatsJob{}
+	err = yaml.Unmarshal(body, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// Peek returns the body of job id
+func (ba *BeanstalkAdmin) Peek(id uint64) ([]byte, error) {
+	_, body, err := ba.sendGetJob(fmt.Sprintf("peek %d\r\n", id))
+	return body, err
+}
+
+// PeekBuried returns the id and body of the next job to be kicked in
+// tube, or ErrNotFound if none are buried
+func (ba *BeanstalkAdmin) PeekBuried(tube string) (uint64, []byte, error) {
+	err := ba.use(tube)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return ba.sendGetJob("peek-buried\r\n")
+}
+
+// KickJob method
+func (ba *BeanstalkAdmin) KickJob(id uint64) error {
+	resp, err := ba.send(fmt.Sprintf("kick-job %d\r\n", id))
+	if err != nil {
+		return err
+	}
+	if resp != "KICKED" {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// Put method
+func (ba *BeanstalkAdmin) Put(tube string, body []byte, pri, delay, ttr int) (uint64, error) {
+	err := ba.use(tube)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := ba.send(fmt.Sprintf("put %d %d %d %d\r\n%s\r\n", pri, delay, ttr, len(body), body))
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint64
+	_, err = fmt.Sscanf(resp, "INSERTED %d", &id)
+	if err != nil {
+		return 0, responseError(resp)
+	}
+
+	return id, nil
+}
+
+// Delete method
+func (ba *BeanstalkAdmin) Delete(id uint64) error {
+	resp, err := ba.send(fmt.Sprintf("delete %d\r\n", id))
+	if err != nil {
+		return err
+	}
+	if resp != "DELETED" {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// Close method
+func (ba *BeanstalkAdmin) Close() error {
+	_, _ = io.WriteString(ba.conn, "quit\r\n")
+	return ba.conn.Close()
+}
+
+// sendGetBody sends cmd and returns the body of an "OK <bytes>" response
+func (ba *BeanstalkAdmin) sendGetBody(cmd string) ([]byte, error) {
+	resp, err := ba.send(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	_, err = fmt.Sscanf(resp, "OK %d", &n)
+	if err != nil {
+		return nil, responseError(resp)
+	}
+
+	return ba.readBody(n)
+}
+
+// sendGetJob sends cmd and returns the job of a "FOUND <id> <bytes>"
+// response
+func (ba *BeanstalkAdmin) sendGetJob(cmd string) (uint64, []byte, error) {
+	resp, err := ba.send(cmd)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var id uint64
+	var n int
+	_, err = fmt.Sscanf(resp, "FOUND %d %d", &id, &n)
+	if err != nil {
+		return 0, nil, responseError(resp)
+	}
+
+	body, err := ba.readBody(n)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return id, body, nil
+}
+
+// use makes tube the one put and peek-buried act on
+func (ba *BeanstalkAdmin) use(tube string) error {
+	resp, err := ba.send(fmt.Sprintf("use %s\r\n", tube))
+	if err != nil {
+		return err
+	}
+	if resp != "USING "+tube {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// responseError turns an unexpected response line into an error
+func responseError(resp string) error {
+	if resp == "NOT_FOUND" {
+		return ErrNotFound
+	}
+
+	return errors.New(strings.ToLower(strings.Replace(resp, "_", " ", -1)))
+}
+
+// send writes cmd and returns the response line, without its trailing CRLF
+func (ba *BeanstalkAdmin) send(cmd string) (string, error) {
+	_, err := io.WriteString(ba.conn, cmd)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := ba.rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(resp, "\r\n"), nil
+}
+
+// readBody reads an n byte body and its trailing CRLF
+func (ba *BeanstalkAdmin) readBody(n int) ([]byte, error) {
+	body := make([]byte, n+2)
+	_, err := io.ReadFull(ba.rd, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return body[:n], nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	beanstalk "github.com/JalfResi/gobeanstalk"
+)
+
+// Reconnect backoff: the delay between dials doubles from
+// reconnectBaseDelay up to reconnectMaxDelay
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = 30 * time.Second
+)
+
+// BeanstalkConn is a worker's beanstalkd connection. After a connection
+// error Reconnect redials with backoff, watching and using the same
+// tubes as before, until it succeeds or beanstalkd has been unreachable
+// for longer than the outage window, when the process exits.
+type BeanstalkConn struct {
+	*beanstalk.Conn
+	addr    string
+	outage  time.Duration
+	watched []string
+	used    string
+	log     *Logger
+}
+
+// NewBeanstalkConn BeanstalkConn constructor
+// Call Connect before use.
+func NewBeanstalkConn(addr string, outage time.Duration, log *Logger) *BeanstalkConn {
+	return &BeanstalkConn{
+		addr:   addr,
+		outage: outage,
+		log:    log,
+	}
+}
+
+// Connect dials beanstalkd, retrying as Reconnect does. It returns false
+// if quit is closed first.
+func (bc *BeanstalkConn) Connect(quit <-chan struct{}) bool {
+	return bc.redial(quit)
+}
+
+// Reconnect replaces a broken connection, logging why in err. It
+// returns false if quit is closed first. Jobs reserved on the broken
+// connection are released by beanstalkd.
+func (bc *BeanstalkConn) Reconnect(quit <-chan struct{}, err error) bool {
+	bc.log.Warnf("Beanstalk %s connection lost: %s; reconnecting", bc.addr, err)
+	beanstalkState.lose()
+	if bc.Conn != nil {
+		bc.Conn.Quit()
+		bc.Conn = nil
+	}
+
+	if !bc.redial(quit) {
+		return false
+	}
+
+	bc.log.Infof("Beanstalk %s reconnected", bc.addr)
+	return true
+}
+
+// WatchOnly watches tubes and ignores every other tube, including the
+// default tube every connection starts out watching. The same tubes are
+// watched again after a reconnect.
+func (bc *BeanstalkConn) WatchOnly(tubes ...string) error {
+	for _, tube := range tubes {
+		if !containsString(bc.watched, tube) {
+			_, err := bc.Conn.Watch(tube)
+			if err != nil {
+				return err
+			}
+			bc.watched = append(bc.watched, tube)
+		}
+	}
+
+	watched := bc.watched[:0]
+	for _, tube := range bc.watched {
+		if containsString(tubes, tube) {
+			watched = append(watched, tube)
+			continue
+		}
+
+		_, err := bc.Conn.Ignore(tube)
+		if err != nil {
+			return err
+		}
+	}
+	bc.watched = watched
+
+	return nil
+}
+
+// Use method
+// The tube is used again after a reconnect.
+func (bc *BeanstalkConn) Use(tube string) error {
+	bc.used = tube
+	return bc.Conn.Use(tube)
+}
+
+// redial dials until connected with the tubes restored, quit is closed
+// or the outage window has passed
+func (bc *BeanstalkConn) redial(quit <-chan struct{}) bool {
+	beanstalkState.wait()
+	defer beanstalkState.waited()
+
+	start := time.Now()
+	delay := reconnectBaseDelay
+
+	for {
+		err := bc.dial()
+		if err == nil {
+			return true
+		}
+
+		if time.Since(start) > bc.outage {
+			bc.log.Fatalf("Beanstalk %s unreachable for %s, giving up: %s", bc.addr, bc.outage, err)
+		}
+		bc.log.Warnf("Beanstalk %s dial failed, retrying in %s: %s", bc.addr, delay, err)
+
+		select {
+		case <-quit:
+			return false
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// dial connects and restores the watched and used tubes
+func (bc *BeanstalkConn) dial() error {
+	conn, err := beanstalk.Dial(bc.addr)
+	if err != nil {
+		return err
+	}
+
+	watched := bc.watched
+	bc.Conn = conn
+	bc.watched = []string{"default"}
+
+	if len(watched) > 0 {
+		err = bc.WatchOnly(watched...)
+	}
+	if err == nil && bc.used != "" {
+		err = conn.Use(bc.used)
+	}
+	if err != nil {
+		conn.Quit()
+		bc.Conn = nil
+		bc.watched = watched
+		return err
+	}
+
+	return nil
+}
+
+// containsString reports whether s is in list
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnError reports whether err from a beanstalk command means the
+// connection is broken, rather than that beanstalkd refused the command
+func isConnError(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// beanstalkState is the connection state of every worker
+var beanstalkState = &BeanstalkState{}
+
+// BeanstalkState counts the workers waiting for a beanstalkd connection
+// and the connections lost so far
+type BeanstalkState struct {
+	sync.Mutex
+	waiting int
+	lost    int
+}
+
+func (bs *BeanstalkState) wait() {
+	bs.Lock()
+	defer bs.Unlock()
+	bs.waiting++
+}
+
+func (bs *BeanstalkState) waited() {
+	bs.Lock()
+	defer bs.Unlock()
+	bs.waiting--
+}
+
+func (bs *BeanstalkState) lose() {
+	bs.Lock()
+	defer bs.Unlock()
+	bs.lost++
+}
+
+// Waiting returns the number of workers without a connection
+func (bs *BeanstalkState) Waiting() int {
+	bs.Lock()
+	defer bs.Unlock()
+	return bs.waiting
+}
+
+// Lost returns the number of connections lost since startup
+func (bs *BeanstalkState) Lost() int {
+	bs.Lock()
+	defer bs.Unlock()
+	return bs.lost
+}
@@ -0,0 +1,74 @@
+package main
+
+import "strings"
+
+// Boilerplate removal is a much simplified take on jusText: a block is
+// article content when it is long, not mostly links and reads like prose
+// (has plenty of stopwords). Shorter prose next to content is kept too,
+// so short paragraphs inside the article survive.
+const (
+	goodBlockWords         = 15
+	nearGoodBlockWords     = 7
+	maxLinkDensity         = 0.25
+	minStopwordDensity     = 0.25
+	minNearStopwordDensity = 0.2
+)
+
+// textBlock is a block level element of a page
+type textBlock struct {
+	text        string
+	linkDensity float64
+}
+
+// removeBoilerplate returns the blocks judged to be article content
+func removeBoilerplate(blocks []textBlock) []textBlock {
+	var all []string
+	for _, b := range blocks {
+		all = append(all, lowerWords(b.text)...)
+	}
+	lang, _ := DetectLanguage(all)
+	stop := stopwords[lang]
+
+	good := make([]bool, len(blocks))
+	near := make([]bool, len(blocks))
+	for i, b := range blocks {
+		words := lowerWords(b.text)
+		if len(words) == 0 || b.linkDensity > maxLinkDensity {
+			continue
+		}
+
+		density := 1.0
+		if stop != nil {
+			n := 0
+			for _, w := range words {
+				if stop[w] {
+					n++
+				}
+			}
+			density = float64(n) / float64(len(words))
+		}
+
+		good[i] = len(words) >= goodBlockWords && density >= minStopwordDensity
+		near[i] = len(words) >= nearGoodBlockWords && density >= minNearStopwordDensity
+	}
+
+	var main []textBlock
+	for i, b := range blocks {
+		if good[i] || (near[i] && ((i > 0 && good[i-1]) || (i+1 < len(blocks) && good[i+1]))) {
+			main = append(main, b)
+		}
+	}
+
+	return main
+}
+
+// lowerWords returns the lower cased words of text
+func lowerWords(text string) []string {
+	var words []string
+	for _, s := range tokenise(text) {
+		for _, w := range s.Words {
+			words = append(words, strings.ToLower(w.Token))
+		}
+	}
+	return words
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// buriedUsage is printed for a malformed buried command
+const buriedUsage = `usage:
+  nusetextd [options] buried [list]
+  nusetextd [options] buried kick all|<job id>...
+  nusetextd [options] buried move all|<job id>...`
+
+// BuriedCommand lets on-call triage the jobs buried in the source tubes:
+// list shows each with its body, age and recorded failure, kick puts
+// jobs back to ready and move puts them in the dead letter tube.
+type BuriedCommand struct {
+	ba             *BeanstalkAdmin
+	failures       *FailureLog
+	tubes          []string
+	deadLetterTube string
+	out            io.Writer
+}
+
+// NewBuriedCommand BuriedCommand constructor
+func NewBuriedCommand(ba *BeanstalkAdmin, failures *FailureLog, tubes []string, deadLetterTube string, out io.Writer) *BuriedCommand {
+	return &BuriedCommand{
+		ba:             ba,
+		failures:       failures,
+		tubes:          tubes,
+		deadLetterTube: deadLetterTube,
+		out:            out,
+	}
+}
+
+// buried runs the buried command against the configured beanstalkd,
+// MySQL and tubes
+func buried(args []string) error {
+	err := config.LoadSourceTubes()
+	if err != nil {
+		return err
+	}
+	tubes := config.SourceTubeNames()
+
+	config.Lock()
+	beanstalkdHost := config.beanstalkdHost
+	deadLetterTube := config.deadLetterTube
+	config.Unlock()
+
+	ba, err := DialBeanstalkAdmin(beanstalkdHost)
+	if err != nil {
+		return fmt.Errorf("Beanstalk connect failed: %s", err)
+	}
+	defer ba.Close()
+
+	db, err := NewMySQLPool(config)
+	if err != nil {
+		return fmt.Errorf("MySQL connect failed: %s", err)
+	}
+	defer db.Close()
+
+	return NewBuriedCommand(ba, NewFailureLog(db), tubes, deadLetterTube, os.Stdout).Run(args)
+}
+
+// Run method
+func (bc *BuriedCommand) Run(args []string) error {
+	if len(args) == 0 {
+		return bc.List()
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) == 1 {
+			return bc.List()
+		}
+	case "kick", "move":
+		ids, err := parseJobIDs(args[1:])
+		if err != nil {
+			return err
+		}
+		if args[0] == "kick" {
+			return bc.Kick(ids)
+		}
+		return bc.Move(ids)
+	}
+
+	return errors.New(buriedUsage)
+}
+
+// List method
+// Failures recorded for jobs since deleted are forgotten.
+func (bc *BuriedCommand) List() error {
+	tw := tabwriter.NewWriter(bc.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTUBE\tAGE\tBURIES\tFAILED AT\tREASON\tBODY")
+
+	var count int
+	for _, tube := range bc.tubes {
+		n, err := bc.list(tw, tube)
+		if err != nil {
+			return err
+		}
+		count += n
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(bc.out, "%d buried in %s\n", count, strings.Join(bc.tubes, ", "))
+	return err
+}
+
+// list writes the buried jobs of tube to tw, returning how many
+func (bc *BuriedCommand) list(tw io.Writer, tube string) (int, error) {
+	ids, failures, err := bc.listed(tube)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, id := range ids {
+		stats, err := bc.ba.StatsJob(id)
+		if err == ErrNotFound {
+			err = bc.failures.Forget(id)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if stats == nil || stats.State != "buried" || stats.Tube != tube {
+			continue
+		}
+
+		body, err := bc.ba.Peek(id)
+		if err != nil {
+			return 0, err
+		}
+
+		failedAt, reason := "-", "-"
+		if f := failures[id]; f != nil {
+			failedAt, reason = f.FailedAt, f.Reason
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", id, tube, time.Duration(stats.Age)*time.Second, stats.Buries, failedAt, reason, body)
+		count++
+	}
+
+	return count, nil
+}
+
+// Kick method
+// Kicks every buried job in the source tubes if ids is nil.
+func (bc *BuriedCommand) Kick(ids []uint64) error {
+	if ids == nil {
+		return bc.eachBuried(bc.kick)
+	}
+
+	for _, id := range ids {
+		err := bc.kick(id)
+		if err == ErrNotFound {
+			logger.Errorf("Job %d is not buried in a source tube", id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Move method
+// Moves every buried job in the source tubes if ids is nil.
+func (bc *BuriedCommand) Move(ids []uint64) error {
+	if ids == nil {
+		return bc.eachBuried(bc.move)
+	}
+
+	for _, id := range ids {
+		err := bc.move(id)
+		if err == ErrNotFound {
+			logger.Errorf("Job %d is not buried in a source tube", id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kick puts a buried job back to ready
+func (bc *BuriedCommand) kick(id uint64) error {
+	stats, err := bc.ba.StatsJob(id)
+	if err != nil {
+		return err
+	}
+	if stats.State != "buried" || !containsString(bc.tubes, stats.Tube) {
+		return ErrNotFound
+	}
+
+	err = bc.ba.KickJob(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(bc.out, "Kicked %d\n", id)
+	return nil
+}
+
+// move puts a buried job in the dead letter tube, with its priority and
+// TTR, and deletes the original
+func (bc *BuriedCommand) move(id uint64) error {
+	stats, err := bc.ba.StatsJob(id)
+	if err != nil {
+		return err
+	}
+	if stats.State != "buried" || !containsString(bc.tubes, stats.Tube) {
+		return ErrNotFound
+	}
+
+	body, err := bc.ba.Peek(id)
+	if err != nil {
+		return err
+	}
+
+	newID, err := bc.ba.Put(bc.deadLetterTube, body, stats.Pri, 0, stats.TTR)
+	if err != nil {
+		return err
+	}
+
+	err = bc.ba.Delete(id)
+	if err != nil {
+		return fmt.Errorf("Job %d copied to %s as %d but not deleted: %s", id, bc.deadLetterTube, newID, err)
+	}
+
+	err = bc.failures.Move(id, newID, bc.deadLetterTube)
+	if err != nil {
+		logger.Errorf("Job %d failure not moved: %s", id, err)
+	}
+
+	fmt.Fprintf(bc.out, "Moved %d to %s as %d\n", id, bc.deadLetterTube, newID)
+	return nil
+}
+
+// eachBuried applies fn to the first buried job in each source tube
+// until there are none left; fn must take the job out of the buried
+// state. It moves on at a job seen before, i.e. kicked and buried again
+// by a worker.
+func (bc *BuriedCommand) eachBuried(fn func(id uint64) error) error {
+	seen := make(map[uint64]bool)
+	for _, tube := range bc.tubes {
+		for {
+			id, _, err := bc.ba.PeekBuried(tube)
+			if err == ErrNotFound || seen[id] {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			seen[id] = true
+
+			err = fn(id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listed returns the ids of the buried jobs in tube List shows, with
+// their recorded failures. As beanstalkd can only peek at the first
+// buried job, the ids are those with a recorded failure plus that first
+// one.
+func (bc *BuriedCommand) listed(tube string) ([]uint64, map[uint64]*JobFailure, error) {
+	failures, err := bc.failures.Failures(tube)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]uint64, 0, len(failures)+1)
+	for id := range failures {
+		ids = append(ids, id)
+	}
+
+	id, _, err := bc.ba.PeekBuried(tube)
+	if err != nil && err != ErrNotFound {
+		return nil, nil, err
+	}
+	if err == nil && failures[id] == nil {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, failures, nil
+}
+
+// parseJobIDs parses the job ids of a kick or move, returning nil for
+// "all"
+func parseJobIDs(args []string) ([]uint64, error) {
+	if len(args) == 0 {
+		return nil, errors.New(buriedUsage)
+	}
+	if len(args) == 1 && args[0] == "all" {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad job id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -11,7 +11,10 @@ package main
 //
 
 import (
+	"database/sql"
 	"flag"
+	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/JalfResi/flagenv"
@@ -22,40 +25,134 @@ import (
 // modifying the config options
 type NusefeedConfig struct {
 	sync.Mutex
-	verbose             bool
-	configTest          bool
-	debug               bool
-	srcTube             string
-	destTube            string
-	beanstalkdHost      string
-	memcachedbHost      string
-	maxRetryAttempts    uint64
-	timeout             int
-	initialWorkerCount  int
-	totalRequestLimit   int
-	currentRequestCount int
-	textRazorAPIKey     string
+	logLevel               string
+	logFormat              string
+	configTest             bool
+	srcTube                string
+	srcTubeOrder           string
+	srcTubes               []SourceTube
+	destTube               string
+	deadLetterTube         string
+	beanstalkdHost         string
+	beanstalkOutage        int
+	memcachedbHost         string
+	cacheTTL               int
+	maxRetryAttempts       uint64
+	timeout                int
+	initialWorkerCount     int
+	maxWorkers             int
+	shutdownTimeout        int
+	workerStall            int
+	adminAddr              string
+	autoscale              bool
+	autoscaleMin           int
+	autoscaleMax           int
+	autoscaleJobsPerWorker int
+	autoscaleInterval      int
+	autoscaleCooldown      int
+	totalRequestLimit      int
+	quotaResetTime         string
+	quotaTimezone          string
+	quotaStatePath         string
+	backlogPolicy          string
+	backlogMaxAge          int
+	backlogPriorityPenalty uint
+	skippedLogPath         string
+	provider               string
+	fallbackProvider       string
+	textRazorAPIKey        string
+	fetchLocally           bool
+	extractors             string
+	cleanupMode            string
+	rulesFile              string
+	entitiesFilter         string
+	entitiesEnrichment     string
+	languageOverride       string
+	profilesPath           string
+	profiles               *ExtractorProfiles
+	mysqlHost              string
+	mysqlPort              int
+	mysqlDatabase          string
+	mysqlUsername          string
+	mysqlPassword          string
+	mysqlMaxOpenConns      int
+	mysqlMaxIdleConns      int
+	db                     *sql.DB
 }
 
-// IncRequestCount method
-func (c *NusefeedConfig) IncRequestCount() {
+// LoadProfiles reads the -profiles file, with the default profile built
+// from the extractor flags, for handing to each worker
+func (c *NusefeedConfig) LoadProfiles() error {
 	c.Lock()
 	defer c.Unlock()
-	c.currentRequestCount++
+
+	profiles, err := NewExtractorProfiles(c.profilesPath, &ExtractorProfile{
+		Extractors:         splitExtractors(c.extractors),
+		CleanupMode:        c.cleanupMode,
+		RulesFile:          c.rulesFile,
+		EntitiesFilter:     c.entitiesFilter,
+		EntitiesEnrichment: c.entitiesEnrichment,
+		LanguageOverride:   c.languageOverride,
+	})
+	if err != nil {
+		return err
+	}
+	c.profiles = profiles
+
+	return nil
 }
 
-// RequestCount method
-func (c *NusefeedConfig) RequestCount() int {
+// LoadSourceTubes parses -src-tube and checks -src-tube-order
+func (c *NusefeedConfig) LoadSourceTubes() error {
 	c.Lock()
 	defer c.Unlock()
-	return c.currentRequestCount
+
+	tubes, err := ParseSourceTubes(c.srcTube)
+	if err != nil {
+		return err
+	}
+
+	_, err = NewTubeSchedule(tubes, c.srcTubeOrder)
+	if err != nil {
+		return err
+	}
+	c.srcTubes = tubes
+
+	return nil
 }
 
-// RequestLimitMet method
-func (c *NusefeedConfig) RequestLimitMet() bool {
+// CheckAutoscale checks that -autoscale-min <= -autoscale-max <=
+// -max-workers when autoscaling
+func (c *NusefeedConfig) CheckAutoscale() error {
 	c.Lock()
 	defer c.Unlock()
-	return (c.currentRequestCount >= c.totalRequestLimit)
+
+	if !c.autoscale {
+		return nil
+	}
+	if c.autoscaleMin < 0 || c.autoscaleMin > c.autoscaleMax {
+		return fmt.Errorf("-autoscale-min %d must be from 0 to -autoscale-max %d", c.autoscaleMin, c.autoscaleMax)
+	}
+	if c.autoscaleMax > c.maxWorkers {
+		return fmt.Errorf("-autoscale-max %d must be at most -max-workers %d", c.autoscaleMax, c.maxWorkers)
+	}
+
+	return nil
+}
+
+// SourceTubeNames returns the names of the loaded source tubes
+func (c *NusefeedConfig) SourceTubeNames() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	return sourceTubeNames(c.srcTubes)
+}
+
+// SetDB sets the shared MySQL connection pool handed to each worker
+func (c *NusefeedConfig) SetDB(db *sql.DB) {
+	c.Lock()
+	defer c.Unlock()
+	c.db = db
 }
 
 var config = &NusefeedConfig{}
@@ -64,21 +161,67 @@ func init() {
 	config.Lock()
 	defer config.Unlock()
 
-	flag.BoolVar(&config.verbose, "verbose", false, "Display verbose information messages")
-	flag.BoolVar(&config.debug, "debug", false, "Display debug messages")
+	flag.StringVar(&config.logLevel, "log-level", "info", "The least severe messages logged: debug, with every job and the calling line, info, warn or error")
+	flag.StringVar(&config.logFormat, "log-format", LogFormatLogfmt, "The log line format: logfmt or json")
 	flag.BoolVar(&config.configTest, "test", false, "Display config options")
-	flag.StringVar(&config.srcTube, "src-tube", "articles", "The source tube")
+	flag.StringVar(&config.srcTube, "src-tube", "articles", "The comma separated source tubes, each optionally with a :weight, e.g. breaking:5,articles")
+	flag.StringVar(&config.srcTubeOrder, "src-tube-order", TubeOrderPriority, "How the source tubes are ordered: priority, in the order listed, or weighted, at random by weight")
+	flag.StringVar(&config.destTube, "dest-tube", "analysed", "The destination tube for analysed articles")
+	flag.StringVar(&config.deadLetterTube, "dead-letter-tube", "articles-dead", "The tube the buried command moves given up articles to")
 	flag.StringVar(&config.beanstalkdHost, "beanstalk", "127.0.0.1:11300", "The beanstalk host")
-	flag.StringVar(&config.memcachedbHost, "memcache", "127.0.0.1:11211", "The memcache host")
-	flag.Uint64Var(&config.maxRetryAttempts, "max-fetch-retries", 3, "The maximum number of attempts to fetch a feed url")
+	flag.IntVar(&config.beanstalkOutage, "beanstalk-outage", 300, "The seconds beanstalkd may be unreachable before nusetextd exits")
+	flag.StringVar(&config.memcachedbHost, "memcache", "127.0.0.1:11211", "The memcache host caching TextRazor results, empty to disable")
+	flag.IntVar(&config.cacheTTL, "cache-ttl", 604800, "The seconds a cached TextRazor result is kept")
+	flag.Uint64Var(&config.maxRetryAttempts, "max-fetch-retries", 3, "The maximum number of attempts to analyse an article before it is buried")
 	flag.IntVar(&config.timeout, "timeout", 30, "The http connection timeout")
 	flag.IntVar(&config.initialWorkerCount, "workers", 2, "The initial worker count")
-	flag.IntVar(&config.totalRequestLimit, "requests", 500, "The maximum TextRazor requests in a 24hr period")
+	flag.IntVar(&config.maxWorkers, "max-workers", 50, "The most workers the admin endpoint or the autoscaler may scale to")
+	flag.IntVar(&config.workerStall, "worker-stall", 600, "The seconds a worker may go without finishing a job or waiting for one before /healthz fails; keep above -timeout and -beanstalk-outage")
+	flag.StringVar(&config.adminAddr, "admin", "127.0.0.1:8300", "The admin HTTP listen address, empty to disable")
+	flag.BoolVar(&config.autoscale, "autoscale", false, "Scale workers from the number of ready jobs in the source tube; the admin endpoint then can't resize them")
+	flag.IntVar(&config.autoscaleMin, "autoscale-min", 1, "The minimum autoscaled worker count")
+	flag.IntVar(&config.autoscaleMax, "autoscale-max", 10, "The maximum autoscaled worker count")
+	flag.IntVar(&config.autoscaleJobsPerWorker, "autoscale-jobs-per-worker", 20, "The number of ready jobs each autoscaled worker is expected to handle")
+	flag.IntVar(&config.autoscaleInterval, "autoscale-interval", 30, "The seconds between source tube depth checks")
+	flag.IntVar(&config.autoscaleCooldown, "autoscale-cooldown", 300, "The minimum seconds between autoscale resizes")
+	flag.IntVar(&config.shutdownTimeout, "shutdown-timeout", 60, "The seconds to wait for workers to finish their current job on shutdown")
+	flag.IntVar(&config.totalRequestLimit, "requests", 500, "The maximum TextRazor requests per day, see -quota-reset")
+	flag.StringVar(&config.quotaResetTime, "quota-reset", "00:00", "The time of day, HH:MM, the TextRazor request count resets")
+	flag.StringVar(&config.quotaTimezone, "quota-timezone", "UTC", "The timezone of -quota-reset")
+	flag.StringVar(&config.quotaStatePath, "quota-state", "nusetextd-quota.json", "The file the TextRazor request count is saved to, empty to not persist it")
+	flag.StringVar(&config.backlogPolicy, "quota-backlog", BacklogReady, "What to do with articles while the quota is exhausted: ready, delay, bury or skip")
+	flag.IntVar(&config.backlogMaxAge, "quota-backlog-max-age", 24, "The age in hours after which the bury and skip backlog policies give up on an article")
+	flag.UintVar(&config.backlogPriorityPenalty, "quota-backlog-penalty", 1024, "The amount the priority of an article put back while the quota is exhausted is lowered by")
+	flag.StringVar(&config.skippedLogPath, "skipped-log", "nusetextd-skipped.log", "The file articles dropped by the skip backlog policy are logged to")
+	flag.StringVar(&config.provider, "provider", ProviderTextRazor, "The analysis provider")
+	flag.StringVar(&config.fallbackProvider, "fallback-provider", "", "The analysis provider used while -provider is out of quota or unreachable, e.g. local")
 	flag.StringVar(&config.textRazorAPIKey, "key", "", "The TextRazor API key")
+	flag.StringVar(&config.extractors, "extractors", strings.Join([]string{
+		ExtractorTopics,
+		ExtractorEntities,
+		ExtractorWords,
+		ExtractorPhrases,
+		ExtractorDependancyTrees,
+		ExtractorRelations,
+		ExtractorEntailments,
+		ExtractorSenses,
+	}, ","), "The comma separated TextRazor extractors of the default profile")
+	flag.StringVar(&config.cleanupMode, "cleanup-mode", ModeCleanHTML, "The TextRazor cleanup mode of the default profile: raw, stripTags or cleanHTML")
+	flag.StringVar(&config.rulesFile, "rules", "", "A file of TextRazor Prolog rules for the default profile")
+	flag.StringVar(&config.entitiesFilter, "entities-filter", "", "The TextRazor entities filter of the default profile")
+	flag.StringVar(&config.entitiesEnrichment, "entities-enrichment", "", "The TextRazor entities enrichment of the default profile")
+	flag.StringVar(&config.languageOverride, "language-override", "", "The TextRazor language override of the default profile")
+	flag.StringVar(&config.profilesPath, "profiles", "", "A YAML file of extractor profiles and the source tubes using them")
+	flag.BoolVar(&config.fetchLocally, "fetch-locally", false, "Download and clean articles locally and send TextRazor just the text, overriding the profiles' cleanup modes with raw")
+	flag.StringVar(&config.mysqlHost, "mysql-host", "127.0.0.1", "The MySQL host")
+	flag.IntVar(&config.mysqlPort, "mysql-port", 3306, "The MySQL port")
+	flag.StringVar(&config.mysqlDatabase, "mysql-database", "nuseagent", "The MySQL database")
+	flag.StringVar(&config.mysqlUsername, "mysql-user", "nusetext", "The MySQL username")
+	flag.StringVar(&config.mysqlPassword, "mysql-password", "", "The MySQL password")
+	flag.IntVar(&config.mysqlMaxOpenConns, "mysql-max-open", 10, "The maximum number of open MySQL connections")
+	flag.IntVar(&config.mysqlMaxIdleConns, "mysql-max-idle", 2, "The maximum number of idle MySQL connections")
 
 	flagenv.Prefix = "NUSETEXT_"
-	flagenv.Parse()
-	flag.Parse()
 }
 
 func newWorkerConfig(c *NusefeedConfig) *WorkerConfig {
@@ -86,11 +229,24 @@ func newWorkerConfig(c *NusefeedConfig) *WorkerConfig {
 	defer c.Unlock()
 
 	return &WorkerConfig{
-		srcTube:          c.srcTube,
+		srcTubes:         c.srcTubes,
+		srcTubeOrder:     c.srcTubeOrder,
 		destTube:         c.destTube,
 		beanstalkdHost:   c.beanstalkdHost,
+		beanstalkOutage:  c.beanstalkOutage,
 		memcachedbHost:   c.memcachedbHost,
+		cacheTTL:         c.cacheTTL,
+		provider:         c.provider,
+		fallbackProvider: c.fallbackProvider,
+		textRazorAPIKey:  c.textRazorAPIKey,
+		fetchLocally:     c.fetchLocally,
+		profiles:         c.profiles,
 		maxRetryAttempts: c.maxRetryAttempts,
 		timeout:          c.timeout,
+		db:               c.db,
+
+		backlogPolicy:          c.backlogPolicy,
+		backlogMaxAge:          c.backlogMaxAge,
+		backlogPriorityPenalty: c.backlogPriorityPenalty,
 	}
 }
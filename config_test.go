@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestCheckAutoscale(t *testing.T) {
+	tests := []struct {
+		autoscale            bool
+		min, max, maxWorkers int
+		ok                   bool
+	}{
+		{true, 1, 10, 50, true},
+		{true, 0, 0, 0, true},
+		{true, 10, 10, 10, true},
+		{true, 5, 3, 50, false},
+		{true, -1, 3, 50, false},
+		{true, 1, 60, 50, false},
+		{false, 5, 3, 2, true}, // not checked unless autoscaling
+	}
+
+	for _, test := range tests {
+		c := &NusefeedConfig{
+			autoscale:    test.autoscale,
+			autoscaleMin: test.min,
+			autoscaleMax: test.max,
+			maxWorkers:   test.maxWorkers,
+		}
+		if err := c.CheckAutoscale(); (err == nil) != test.ok {
+			t.Errorf("autoscale %v %d-%d of %d: %v", test.autoscale, test.min, test.max, test.maxWorkers, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+)
+
+// Corpus holds the document frequency of every term seen by the local
+// analyser, so keywords can be scored by TF-IDF. It lives in MySQL so it
+// keeps growing across restarts and is shared by every worker.
+type Corpus struct {
+	db *sql.DB
+}
+
+// NewCorpus Corpus constructor
+func NewCorpus(db *sql.DB) *Corpus {
+	return &Corpus{
+		db: db,
+	}
+}
+
+// Add counts the distinct terms of the article once. Adding an article
+// a second time changes nothing.
+func (c *Corpus) Add(articleHash string, terms map[string]int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("INSERT IGNORE INTO corpus_documents (articleHash) VALUES( ? )", articleHash) // ? = placeholder
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO corpus_terms (term, documents) VALUES( ?, 1 ) ON DUPLICATE KEY UPDATE documents = documents + 1") // ? = placeholder
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for term := range terms {
+		_, err = stmt.Exec(term)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// IDF returns the inverse document frequency of each of the terms
+func (c *Corpus) IDF(terms map[string]int) (map[string]float64, error) {
+	var documents int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM corpus_documents").Scan(&documents)
+	if err != nil {
+		return nil, err
+	}
+
+	df := make(map[string]int)
+	if len(terms) > 0 {
+		args := make([]interface{}, 0, len(terms))
+		for term := range terms {
+			args = append(args, term)
+		}
+
+		rows, err := c.db.Query("SELECT term, documents FROM corpus_terms WHERE term IN (?"+strings.Repeat(", ?", len(args)-1)+")", args...) // ? = placeholder
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var term string
+			var n int
+			err = rows.Scan(&term, &n)
+			if err != nil {
+				return nil, err
+			}
+			df[term] = n
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	idf := make(map[string]float64)
+	for term := range terms {
+		idf[term] = math.Log(float64(documents+1)/float64(df[term]+1)) + 1
+	}
+
+	return idf, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultProfile is the name of the profile built from the command line
+const defaultProfile = "default"
+
+// ExtractorProfile is the set of TextRazor options an article is
+// analysed with
+type ExtractorProfile struct {
+	Extractors         []string `yaml:"extractors"`
+	CleanupMode        string   `yaml:"cleanupMode"` // only for articles TextRazor downloads; -fetch-locally sends extracted text raw
+	Rules              string   `yaml:"rules"`
+	RulesFile          string   `yaml:"rulesFile"` // read into Rules on load
+	EntitiesFilter     string   `yaml:"entitiesFilter"`
+	EntitiesEnrichment string   `yaml:"entitiesEnrichment"`
+	LanguageOverride   string   `yaml:"languageOverride"`
+}
+
+// Apply sets the profile's options on the request
+func (p *ExtractorProfile) Apply(tr *TextRazorRequest) {
+	tr.SetExtractors(p.Extractors...)
+	tr.CleanupMode = p.CleanupMode
+	tr.Rules = p.Rules
+	tr.EntitiesFilter = p.EntitiesFilter
+	tr.EntitiesEnrichment = p.EntitiesEnrichment
+	tr.LanguageOverride = p.LanguageOverride
+}
+
+// validate checks the extractors and cleanup mode, and reads RulesFile
+func (p *ExtractorProfile) validate() error {
+	if len(p.Extractors) == 0 {
+		return fmt.Errorf("no extractors")
+	}
+	for _, e := range p.Extractors {
+		switch e {
+		case ExtractorEntities, ExtractorTopics, ExtractorWords, ExtractorPhrases,
+			ExtractorDependancyTrees, ExtractorRelations, ExtractorEntailments, ExtractorSenses:
+		default:
+			return fmt.Errorf("unknown extractor %q", e)
+		}
+	}
+
+	switch p.CleanupMode {
+	case "":
+		p.CleanupMode = ModeCleanHTML
+	case ModeRaw, ModeStripTags, ModeCleanHTML:
+	default:
+		return fmt.Errorf("unknown cleanup mode %q", p.CleanupMode)
+	}
+
+	if p.RulesFile != "" {
+		b, err := ioutil.ReadFile(p.RulesFile)
+		if err != nil {
+			return err
+		}
+		p.Rules = string(b)
+	}
+
+	return nil
+}
+
+// ExtractorProfiles holds the named ExtractorProfiles and which one is
+// used for articles from each source tube. Tubes without an entry use
+// the Default profile.
+type ExtractorProfiles struct {
+	Default  string                       `yaml:"default"`
+	Tubes    map[string]string            `yaml:"tubes"`
+	Profiles map[string]*ExtractorProfile `yaml:"profiles"`
+}
+
+// NewExtractorProfiles returns the profiles from the YAML file path,
+// which may be empty, with def as the "default" profile unless the file
+// defines its own. For example:
+//
+//	default: full
+//	tubes:
+//	  articles: topics-only
+//	profiles:
+//	  topics-only:
+//	    extractors: [topics]
+//	  full:
+//	    extractors: [topics, entities, relations]
+//	    rulesFile: /etc/nusetextd/rules.pl
+func NewExtractorProfiles(path string, def *ExtractorProfile) (*ExtractorProfiles, error) {
+	ep := &ExtractorProfiles{}
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.Unmarshal(b, ep)
+		if err != nil {
+			return nil, fmt.Errorf("Extractor profiles %s: %s", path, err)
+		}
+	}
+
+	if ep.Profiles == nil {
+		ep.Profiles = make(map[string]*ExtractorProfile)
+	}
+	if _, ok := ep.Profiles[defaultProfile]; !ok {
+		ep.Profiles[defaultProfile] = def
+	}
+	if ep.Default == "" {
+		ep.Default = defaultProfile
+	}
+
+	for name, p := range ep.Profiles {
+		err := p.validate()
+		if err != nil {
+			return nil, fmt.Errorf("Extractor profile %s: %s", name, err)
+		}
+	}
+
+	if _, ok := ep.Profiles[ep.Default]; !ok {
+		return nil, fmt.Errorf("Unknown default extractor profile %q", ep.Default)
+	}
+	for tube, name := range ep.Tubes {
+		if _, ok := ep.Profiles[name]; !ok {
+			return nil, fmt.Errorf("Unknown extractor profile %q for tube %s", name, tube)
+		}
+	}
+
+	return ep, nil
+}
+
+// ForArticle returns the profile named by the article's job, or else
+// the profile for its source tube
+func (ep *ExtractorProfiles) ForArticle(u *ArticleURL) *ExtractorProfile {
+	name := ep.ProfileName(u)
+	if u.Meta.Profile != "" && name != u.Meta.Profile {
+		u.Log().Warnf("Unknown extractor profile %q; using the tube's", u.Meta.Profile)
+	}
+	return ep.Profiles[name]
+}
+
+// ProfileName returns the name of the profile ForArticle returns
+func (ep *ExtractorProfiles) ProfileName(u *ArticleURL) string {
+	if _, ok := ep.Profiles[u.Meta.Profile]; ok {
+		return u.Meta.Profile
+	}
+	if name, ok := ep.Tubes[u.stats.Tube]; ok {
+		return name
+	}
+	return ep.Default
+}
+
+// splitExtractors splits a comma separated extractor list
+func splitExtractors(s string) []string {
+	var extractors []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			extractors = append(extractors, e)
+		}
+	}
+	return extractors
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// JobFailure is the recorded reason a job was buried
+type JobFailure struct {
+	JobID    uint64
+	Tube     string
+	Reason   string
+	FailedAt string
+}
+
+// FailureLog records in MySQL why jobs were buried, since beanstalkd
+// keeps no reason itself. It is what the buried command reads.
+type FailureLog struct {
+	db *sql.DB
+}
+
+// NewFailureLog FailureLog constructor
+func NewFailureLog(db *sql.DB) *FailureLog {
+	return &FailureLog{
+		db: db,
+	}
+}
+
+// Record method
+// Replaces any earlier failure recorded for the job, so a buried job
+// kicked back into its tube has its attempts counted afresh.
+func (fl *FailureLog) Record(jobID uint64, tube string, reason error) error {
+	_, err := fl.db.Exec("REPLACE INTO job_failures (jobId, tube, reason, failedAt) VALUES( ?, ?, ?, ? )", // ? = placeholder
+		jobID,
+		tube,
+		reason.Error(),
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// Attempt records a failed attempt at the job, returning how many
+// there have been since it was last buried
+func (fl *FailureLog) Attempt(jobID uint64, tube string, reason error) (int, error) {
+	_, err := fl.db.Exec("INSERT INTO job_failures (jobId, tube, reason, failedAt, attempts) VALUES( ?, ?, ?, ?, 1 ) "+
+		"ON DUPLICATE KEY UPDATE reason = VALUES(reason), failedAt = VALUES(failedAt), attempts = attempts + 1", // ? = placeholder
+		jobID,
+		tube,
+		reason.Error(),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = fl.db.QueryRow("SELECT attempts FROM job_failures WHERE jobId = ?", jobID).Scan(&attempts) // ? = placeholder
+	return attempts, err
+}
+
+// Failures returns the failures recorded for jobs in tube
+func (fl *FailureLog) Failures(tube string) (map[uint64]*JobFailure, error) {
+	rows, err := fl.db.Query("SELECT jobId, tube, reason, failedAt FROM job_failures WHERE tube = ?", tube) // ? = placeholder
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make(map[uint64]*JobFailure)
+	for rows.Next() {
+		f := &JobFailure{}
+		err = rows.Scan(&f.JobID, &f.Tube, &f.Reason, &f.FailedAt)
+		if err != nil {
+			return nil, err
+		}
+		failures[f.JobID] = f
+	}
+
+	return failures, rows.Err()
+}
+
+// Move method
+// Follows a job put again under a new id in another tube.
+func (fl *FailureLog) Move(jobID, newJobID uint64, tube string) error {
+	_, err := fl.db.Exec("UPDATE job_failures SET jobId = ?, tube = ? WHERE jobId = ?", newJobID, tube, jobID) // ? = placeholder
+	return err
+}
+
+// Forget method
+func (fl *FailureLog) Forget(jobID uint64) error {
+	_, err := fl.db.Exec("DELETE FROM job_failures WHERE jobId = ?", jobID) // ? = placeholder
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// workerHealth tracks the progress of every worker
+var workerHealth = &WorkerHealth{
+	beats:    make(map[<-chan struct{}]time.Time),
+	watching: make(map[<-chan struct{}]bool),
+}
+
+// WorkerHealth records when each worker, known by its quit channel, last
+// went round its loop, and whether it is watching the source tubes. A
+// worker that has not gone round within the stall window is taken to be
+// stuck.
+type WorkerHealth struct {
+	sync.Mutex
+	beats    map[<-chan struct{}]time.Time
+	watching map[<-chan struct{}]bool
+}
+
+// Beat records that the worker is making progress
+func (wh *WorkerHealth) Beat(w <-chan struct{}) {
+	wh.Sleep(w, time.Now())
+}
+
+// Sleep records that the worker will be idle until t, e.g. waiting for
+// the quota to reset, and is not stuck meanwhile
+func (wh *WorkerHealth) Sleep(w <-chan struct{}, t time.Time) {
+	wh.Lock()
+	defer wh.Unlock()
+	wh.beats[w] = t
+}
+
+// Forget method
+// Called as a worker stops.
+func (wh *WorkerHealth) Forget(w <-chan struct{}) {
+	wh.Lock()
+	defer wh.Unlock()
+	delete(wh.beats, w)
+	delete(wh.watching, w)
+}
+
+// Watching records whether the worker's connection is watching the
+// source tubes
+func (wh *WorkerHealth) Watching(w <-chan struct{}, watching bool) {
+	wh.Lock()
+	defer wh.Unlock()
+	wh.watching[w] = watching
+}
+
+// WatchingCount returns the number of workers watching the source tubes
+func (wh *WorkerHealth) WatchingCount() int {
+	wh.Lock()
+	defer wh.Unlock()
+
+	var n int
+	for _, watching := range wh.watching {
+		if watching {
+			n++
+		}
+	}
+	return n
+}
+
+// Stalled returns the number of workers that have not gone round their
+// loop within window
+func (wh *WorkerHealth) Stalled(window time.Duration) int {
+	wh.Lock()
+	defer wh.Unlock()
+
+	var stalled int
+	for _, t := range wh.beats {
+		if time.Since(t) > window {
+			stalled++
+		}
+	}
+	return stalled
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	beanstalk "github.com/JalfResi/gobeanstalk"
+)
+
+// Heartbeat touches a reserved job every half TTR, so however short
+// the job's TTR beanstalkd does not hand it to another worker while it
+// is still being analysed and stored. The beanstalk connection is not
+// safe for concurrent use, so nothing else may use it until Stop
+// returns.
+type Heartbeat struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Heartbeat starts a Heartbeat for the reserved article
+func (as *ArticleSupplier) Heartbeat(au *ArticleURL) *Heartbeat {
+	hb := &Heartbeat{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	// beanstalkd never gives a job a TTR under a second
+	interval := time.Duration(au.stats.TTR) * time.Second / 2
+	if interval < time.Second/2 {
+		interval = time.Second / 2
+	}
+
+	go hb.run(as.bsConn.Conn, au.job.ID, interval, au.Log())
+
+	return hb
+}
+
+// Stop method
+// Returns once the last touch has completed.
+func (hb *Heartbeat) Stop() {
+	close(hb.stop)
+	<-hb.done
+}
+
+func (hb *Heartbeat) run(bs *beanstalk.Conn, id uint64, interval time.Duration, log *Logger) {
+	defer close(hb.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hb.stop:
+			return
+		case <-ticker.C:
+			err := bs.Touch(id)
+			if err != nil {
+				log.Errorf("Touch failed: %s", err)
+			}
+		}
+	}
+}
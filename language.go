@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// stopwords holds common words for each language, keyed by the ISO 639-2
+// code TextRazor reports. They are used to guess an article's language
+// and are never keywords.
+var stopwords = map[string]map[string]bool{
+	"eng": wordSet("the and of to a in is that it for was on are as with his they at be this from have or by one had not but what all were when we there can an your which their said if do will each about how up out them then she many some so these would other into has more her two like him see time could no make than first been its who now people my made over did down only way find use may long little very after words called just where most know get through back much go good new write our me man too any day same right look think also around another came come work three word must because does part even place well such here take why things help put years different away again off went old number great tell men say small every found still between name should home big give air line set own under read last never us left end along while might next sound below saw something thought both few those always looked show large often together asked house don't world going want"),
+	"fre": wordSet("le la les de des du un une et est en que qui dans pour pas sur au aux avec ce cette ces il elle ils elles nous vous se sa son ses leur leurs mais ou par plus ne été être avoir fait comme tout bien aussi"),
+	"ger": wordSet("der die das und ist nicht ein eine einer eines dem den des zu mit von auf für sich im dass es auch als an wie aus bei nach wird sind war oder aber noch nur so wenn um hat haben werden über"),
+	"spa": wordSet("el la los las de del y en que es un una por con para no se su sus al lo como más pero ha fue son está este esta entre cuando muy sin sobre también ya hay donde"),
+	"ita": wordSet("il lo la gli le di del della dei e è un una per che non con su si sono da al alla come più ma anche questo questa nel nella ha tra fra dopo essere stato"),
+	"dut": wordSet("de het een en van in is dat op te zijn met voor niet aan er maar om ook als bij door naar uit dan nog wel geen werd worden heeft tot over"),
+	"por": wordSet("o a os as de do da dos das e em um uma para com não que se por mais mas foi ao na no como seu sua ou são está também entre quando muito já"),
+}
+
+// wordSet splits a space separated word list into a set
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// DetectLanguage guesses the language of the lower cased words from
+// their stopwords. The guess is reliable when the best language matched
+// at least twice as many words as the runner up.
+func DetectLanguage(words []string) (lang string, reliable bool) {
+	languages := make([]string, 0, len(stopwords))
+	for l := range stopwords {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+
+	best, second := 0, 0
+	for _, l := range languages {
+		set := stopwords[l]
+		n := 0
+		for _, w := range words {
+			if set[w] {
+				n++
+			}
+		}
+
+		switch {
+		case n > best:
+			lang, best, second = l, n, best
+		case n > second:
+			second = n
+		}
+	}
+
+	if best == 0 {
+		return "", false
+	}
+	return lang, best >= 2*second && best >= 5
+}
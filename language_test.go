@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text     string
+		lang     string
+		reliable bool
+	}{
+		{"the minister said that it was time for the government to act on the report", "eng", true},
+		{"le ministre a dit que le gouvernement doit agir sur le rapport et pour les citoyens", "fre", true},
+		{"der Minister sagte dass die Regierung nicht mit dem Bericht zu tun hat und es auch war", "ger", true},
+		// too few stopwords to be sure
+		{"the minister resigned", "eng", false},
+		// as many Spanish as Portuguese stopwords
+		{"de que se por", "por", false},
+		{"", "", false},
+		{"Obama Macron Paris", "", false},
+	}
+
+	for _, test := range tests {
+		lang, reliable := DetectLanguage(strings.Fields(strings.ToLower(test.text)))
+		if lang != test.lang || reliable != test.reliable {
+			t.Errorf("DetectLanguage(%q) = %q %v, want %q %v", test.text, lang, reliable, test.lang, test.reliable)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProviderLocal is the -provider name of the LocalAnalyser
+const ProviderLocal = "local"
+
+const (
+	// localTopicCount is the number of keywords the LocalAnalyser
+	// reports as topics
+	localTopicCount = 10
+
+	// localEntityCount is the most capitalised phrases the LocalAnalyser
+	// reports as entities
+	localEntityCount = 25
+
+	// localConfidence scales every LocalAnalyser score, marking them as
+	// far less trustworthy than a real NLP provider's
+	localConfidence = 0.25
+
+	// maxTermLength is the longest keyword, in bytes, the corpus stores
+	maxTermLength = 64
+)
+
+// LocalAnalyser is a dependency free ArticleAnalyser which fetches the
+// article itself. Topics are the article's keywords scored by TF-IDF
+// against a Corpus of previously analysed articles, and entities are its
+// capitalised phrases. It needs no API and has no quota, so it serves as
+// a fallback provider.
+type LocalAnalyser struct {
+	userAgent string
+	timeout   time.Duration
+	corpus    *Corpus
+}
+
+// NewLocalAnalyser LocalAnalyser constructor
+func NewLocalAnalyser(userAgent string, timeout int, corpus *Corpus) *LocalAnalyser {
+	return &LocalAnalyser{
+		userAgent: userAgent,
+		timeout:   time.Duration(timeout) * time.Second,
+		corpus:    corpus,
+	}
+}
+
+// localRaw is archived as the LocalAnalyser's raw response
+type localRaw struct {
+	URL  string `json:"url"`
+	Text string `json:"text"`
+}
+
+// Analyse method
+func (la *LocalAnalyser) Analyse(u *ArticleURL) (*Analysis, error) {
+	fa, err := FetchArticle(NewTimeoutClient(la.timeout), u.String(), la.userAgent, u.Log())
+	if err != nil {
+		return nil, err
+	}
+
+	text := fa.MainText()
+	sentences := tokenise(text)
+
+	var lower []string
+	for _, s := range sentences {
+		for _, w := range s.Words {
+			lower = append(lower, strings.ToLower(w.Token))
+		}
+	}
+	lang, reliable := DetectLanguage(lower)
+	if _, ok := stopwords[u.Meta.LanguageHint]; ok && !reliable {
+		lang = u.Meta.LanguageHint
+	}
+
+	raw, err := json.Marshal(&localRaw{URL: fa.URL, Text: text})
+	if err != nil {
+		return nil, err
+	}
+
+	terms := termCounts(lower, lang)
+
+	return &Analysis{
+		URL:                u.String(),
+		Provider:           ProviderLocal,
+		AnalysedAt:         time.Now().UTC(),
+		Language:           lang,
+		LanguageIsReliable: reliable,
+		Topics:             la.keywords(u, terms),
+		Entities:           capitalisedPhrases(sentences, lang),
+		Sentences:          sentences,
+		Fetch:              fa.Info(),
+		Raw:                raw,
+	}, nil
+}
+
+// keywords returns the terms with the highest TF-IDF as topics, adding
+// the article to the corpus. Without a corpus every IDF is 1.
+func (la *LocalAnalyser) keywords(u *ArticleURL, terms map[string]int) []Topic {
+	idf := make(map[string]float64)
+	if la.corpus != nil {
+		var err error
+		idf, err = la.corpus.IDF(terms)
+		if err != nil {
+			u.Log().Errorf("Corpus IDF: %s", err)
+		}
+
+		err = la.corpus.Add(generateHash(u.String()), terms)
+		if err != nil {
+			u.Log().Errorf("Corpus add: %s", err)
+		}
+	}
+
+	total := 0
+	for _, n := range terms {
+		total += n
+	}
+
+	topics := make([]Topic, 0, len(terms))
+	for term, n := range terms {
+		weight, ok := idf[term]
+		if !ok {
+			weight = 1
+		}
+		topics = append(topics, Topic{Label: term, Score: float64(n) / float64(total) * weight})
+	}
+
+	sort.Slice(topics, func(i, j int) bool {
+		if topics[i].Score == topics[j].Score {
+			return topics[i].Label < topics[j].Label
+		}
+		return topics[i].Score > topics[j].Score
+	})
+	if len(topics) > localTopicCount {
+		topics = topics[:localTopicCount]
+	}
+
+	// Normalise so the best keyword scores localConfidence
+	if len(topics) > 0 {
+		best := topics[0].Score
+		for i := range topics {
+			topics[i].Score = topics[i].Score / best * localConfidence
+		}
+	}
+
+	return topics
+}
+
+// tokenise splits text into sentences of words. Words are runs of
+// letters and digits, allowing inner apostrophes and hyphens; sentences
+// end at . ! ? or a line break.
+func tokenise(text string) []Sentence {
+	var sentences []Sentence
+	current := Sentence{}
+	position := 0
+	start := -1
+
+	addWord := func(end int) {
+		token := strings.TrimRight(text[start:end], "'’-")
+		current.Words = append(current.Words, Word{
+			Position:    position,
+			StartingPos: start,
+			EndingPos:   start + len(token),
+			Token:       token,
+		})
+		position++
+		start = -1
+	}
+
+	endSentence := func() {
+		if len(current.Words) > 0 {
+			sentences = append(sentences, current)
+		}
+		current = Sentence{Position: len(sentences)}
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || (start >= 0 && strings.ContainsRune("'’-", r)) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 {
+			addWord(i)
+		}
+
+		if strings.ContainsRune(".!?\n", r) {
+			endSentence()
+		}
+	}
+
+	if start >= 0 {
+		addWord(len(text))
+	}
+	endSentence()
+
+	return sentences
+}
+
+// termCounts counts the keyword candidates among the lower cased words,
+// skipping short words, numbers and the stopwords of lang
+func termCounts(words []string, lang string) map[string]int {
+	stop, ok := stopwords[lang]
+	if !ok {
+		stop = stopwords["eng"]
+	}
+
+	terms := make(map[string]int)
+	for _, w := range words {
+		if utf8.RuneCountInString(w) < 3 || len(w) > maxTermLength || stop[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms[w]++
+	}
+
+	return terms
+}
+
+// capitalisedPhrases returns runs of capitalised words as entities, most
+// frequent first. Leading stopwords are dropped, as is a lone word
+// starting a sentence, since capitals there say nothing.
+func capitalisedPhrases(sentences []Sentence, lang string) []Entity {
+	stop, ok := stopwords[lang]
+	if !ok {
+		stop = stopwords["eng"]
+	}
+
+	counts := make(map[string]int)
+	tokens := make(map[string][]int)
+	var order []string
+
+	for _, s := range sentences {
+		for i := 0; i < len(s.Words); {
+			j := i
+			for j < len(s.Words) && isCapitalised(s.Words[j].Token) {
+				j++
+			}
+			if j == i {
+				i++
+				continue
+			}
+
+			k := i
+			for k < j && stop[strings.ToLower(s.Words[k].Token)] {
+				k++
+			}
+
+			if k < j && !(k == 0 && j == 1) {
+				words := make([]string, 0, j-k)
+				positions := make([]int, 0, j-k)
+				for _, w := range s.Words[k:j] {
+					words = append(words, w.Token)
+					positions = append(positions, w.Position)
+				}
+
+				phrase := strings.Join(words, " ")
+				if counts[phrase] == 0 {
+					order = append(order, phrase)
+					tokens[phrase] = positions
+				}
+				counts[phrase]++
+			}
+			i = j
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+	if len(order) > localEntityCount {
+		order = order[:localEntityCount]
+	}
+
+	entities := make([]Entity, 0, len(order))
+	for _, phrase := range order {
+		entities = append(entities, Entity{
+			ID:             phrase,
+			MatchedText:    phrase,
+			MatchingTokens: tokens[phrase],
+			Confidence:     localConfidence,
+			Relevance:      float64(counts[phrase]) / float64(counts[order[0]]) * localConfidence,
+		})
+	}
+
+	return entities
+}
+
+// isCapitalised reports whether the word starts with an upper case letter
+func isCapitalised(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenise(t *testing.T) {
+	text := "Don't stop-believing! It's 2017.\nNew line ’quoted’ end-"
+
+	want := []Sentence{
+		{Position: 0, Words: []Word{
+			{Position: 0, StartingPos: 0, EndingPos: 5, Token: "Don't"},
+			{Position: 1, StartingPos: 6, EndingPos: 20, Token: "stop-believing"},
+		}},
+		{Position: 1, Words: []Word{
+			{Position: 2, StartingPos: 22, EndingPos: 26, Token: "It's"},
+			{Position: 3, StartingPos: 27, EndingPos: 31, Token: "2017"},
+		}},
+		{Position: 2, Words: []Word{
+			{Position: 4, StartingPos: 33, EndingPos: 36, Token: "New"},
+			{Position: 5, StartingPos: 37, EndingPos: 41, Token: "line"},
+			{Position: 6, StartingPos: 45, EndingPos: 51, Token: "quoted"},
+			{Position: 7, StartingPos: 55, EndingPos: 58, Token: "end"},
+		}},
+	}
+
+	got := tokenise(text)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenise(%q) =\n%+v\nwant\n%+v", text, got, want)
+	}
+	for _, s := range got {
+		for _, w := range s.Words {
+			if text[w.StartingPos:w.EndingPos] != w.Token {
+				t.Errorf("word %d offsets %d:%d are %q, not %q", w.Position, w.StartingPos, w.EndingPos, text[w.StartingPos:w.EndingPos], w.Token)
+			}
+		}
+	}
+}
+
+func TestTokeniseNoWords(t *testing.T) {
+	for _, text := range []string{"", "...", " \n!? -- "} {
+		if got := tokenise(text); got != nil {
+			t.Errorf("tokenise(%q) = %+v, want none", text, got)
+		}
+	}
+}
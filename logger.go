@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line
+type Level int
+
+// log levels
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	levelFatal // Logger.Fatalf only; always written
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > levelFatal {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a -log-level
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames[:levelFatal] {
+		if s == name {
+			return Level(l), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown log level %q, expected one of %s", s, strings.Join(levelNames[:levelFatal], ", "))
+}
+
+// log format constants
+const (
+	LogFormatLogfmt string = "logfmt" // time=... level=info msg="..." job=12
+	LogFormatJSON   string = "json"   // one JSON object per line
+)
+
+// logger is the process wide Logger, set up by main from -log-level and
+// -log-format. Workers and jobs log through Loggers derived from it with
+// With, so their lines carry the worker, job and stage.
+var logger = &Logger{
+	out: &logOutput{w: os.Stderr, format: LogFormatLogfmt, level: LevelInfo},
+}
+
+// logSkipped logs the articles dropped by the skip backlog policy, see
+// -skipped-log
+var logSkipped = &Logger{
+	out: &logOutput{w: nil, format: LogFormatLogfmt, level: LevelInfo},
+}
+
+// logOutput is the writer shared by a Logger and those derived from it
+type logOutput struct {
+	sync.Mutex
+	w      io.Writer // nil to discard
+	format string
+	level  Level
+	caller bool // add the file:line of the call, at the debug level
+}
+
+// Logger writes leveled, structured log lines: a time, level and
+// message followed by the key value pairs of its fields
+type Logger struct {
+	out    *logOutput
+	fields []interface{}
+}
+
+// NewLogger Logger constructor
+// Lines below level are dropped.
+func NewLogger(w io.Writer, format string, level Level) (*Logger, error) {
+	switch format {
+	case LogFormatLogfmt, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("Unknown log format %q, expected logfmt or json", format)
+	}
+
+	return &Logger{
+		out: &logOutput{w: w, format: format, level: level, caller: level == LevelDebug},
+	}, nil
+}
+
+// With returns a Logger adding the key value pairs kv to every line,
+// after those of l
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{
+		out:    l.out,
+		fields: fields,
+	}
+}
+
+// Enabled reports whether lines at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l.out.w != nil && level >= l.out.level
+}
+
+// Debugf method
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(LevelDebug, format, args...)
+}
+
+// Infof method
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(LevelInfo, format, args...)
+}
+
+// Warnf method
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(LevelWarn, format, args...)
+}
+
+// Errorf method
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(LevelError, format, args...)
+}
+
+// Fatalf logs at the fatal level, whatever -log-level, then exits
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.log(levelFatal, format, args...)
+	os.Exit(1)
+}
+
+// log writes a line; it must be called directly by the level methods so
+// the caller is found
+func (l *Logger) log(level Level, format string, args ...interface{}) {
+	if level != levelFatal && !l.Enabled(level) {
+		return
+	}
+
+	kv := []interface{}{
+		"time", time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		"level", level.String(),
+		"msg", strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"),
+	}
+	if l.out.caller {
+		if _, file, line, ok := runtime.Caller(2); ok {
+			kv = append(kv, "caller", fmt.Sprintf("%s:%d", filepath.Base(file), line))
+		}
+	}
+	kv = append(kv, l.fields...)
+
+	var buf bytes.Buffer
+	if l.out.format == LogFormatJSON {
+		writeJSONLine(&buf, kv)
+	} else {
+		writeLogfmtLine(&buf, kv)
+	}
+
+	w := l.out.w
+	if w == nil {
+		w = os.Stderr
+	}
+
+	l.out.Lock()
+	defer l.out.Unlock()
+	w.Write(buf.Bytes())
+}
+
+// writeLogfmtLine writes kv as key=value pairs, quoting values that need it
+func writeLogfmtLine(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(kv[i]))
+		buf.WriteByte('=')
+
+		s := fmt.Sprint(logValue(kv, i+1))
+		if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeJSONLine writes kv as a JSON object, keeping the keys in order
+func writeJSONLine(buf *bytes.Buffer, kv []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(kv[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(logValue(kv, i+1))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(logValue(kv, i+1)))
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+}
+
+// logValue returns the value at i in kv, as a string for errors and
+// Stringers so durations, URLs and the like read as they print
+func logValue(kv []interface{}, i int) interface{} {
+	if i >= len(kv) {
+		return "(MISSING)"
+	}
+
+	switch v := kv[i].(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return kv[i]
+}
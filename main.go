@@ -3,24 +3,46 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"math/rand"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
-)
-
-const (
-	logPrefixInfo  = "INFO "
-	logPrefixError = "ERROR "
-)
+	"syscall"
+	"time"
 
-var (
-	logInfo  = log.New(ioutil.Discard, logPrefixInfo, log.Ldate|log.Ltime)
-	logError = log.New(os.Stderr, logPrefixError, log.Ldate|log.Ltime)
+	"github.com/JalfResi/flagenv"
 )
 
 func main() {
+	// Parsed here rather than in init so go test can add its own flags
+	flagenv.Parse()
+	flag.Parse()
+
 	runtime.GOMAXPROCS(runtime.NumCPU())
+	rand.Seed(time.Now().UnixNano())
+
+	config.Lock()
+	logLevel := config.logLevel
+	logFormat := config.logFormat
+	config.Unlock()
+	level, err := ParseLevel(logLevel)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	l, err := NewLogger(os.Stderr, logFormat, level)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	logger = l
+
+	if flag.NArg() > 0 {
+		err := runCommand(flag.Arg(0), flag.Args()[1:])
+		if err != nil {
+			logger.Fatalf("%s", err)
+		}
+		os.Exit(0)
+	}
 
 	fmt.Printf("NuseText is starting...\n")
 
@@ -28,28 +50,109 @@ func main() {
 		flag.PrintDefaults()
 
 		fmt.Println("\nCurrent configuration")
-		fmt.Printf("verbose: %+v\n", config.verbose)
-		fmt.Printf("debug: %+v\n", config.debug)
+		fmt.Printf("log: %+v %+v\n", config.logLevel, config.logFormat)
 		fmt.Printf("config-test: %+v\n", config.configTest)
-		fmt.Printf("src-tube: %+v\n", config.srcTube)
-		fmt.Printf("beanstalkd: %+v\n", config.beanstalkdHost)
+		fmt.Printf("src-tube: %+v (%s order)\n", config.srcTube, config.srcTubeOrder)
+		fmt.Printf("dest-tube: %+v\n", config.destTube)
+		fmt.Printf("dead-letter-tube: %+v\n", config.deadLetterTube)
+		fmt.Printf("beanstalkd: %+v (outage %ds)\n", config.beanstalkdHost, config.beanstalkOutage)
 		fmt.Printf("memcachedb: %+v\n", config.memcachedbHost)
+		fmt.Printf("cache-ttl: %+v\n", config.cacheTTL)
 		fmt.Printf("max-fetch-retries: %+v\n", config.maxRetryAttempts)
 		fmt.Printf("timeout: %+v\n", config.timeout)
-		fmt.Printf("workers: %+v\n", config.initialWorkerCount)
+		fmt.Printf("provider: %+v\n", config.provider)
+		fmt.Printf("fallback-provider: %+v\n", config.fallbackProvider)
+		fmt.Printf("fetch-locally: %+v\n", config.fetchLocally)
+		fmt.Printf("extractors: %+v\n", config.extractors)
+		fmt.Printf("cleanup-mode: %+v\n", config.cleanupMode)
+		fmt.Printf("rules: %+v\n", config.rulesFile)
+		fmt.Printf("entities-filter: %+v\n", config.entitiesFilter)
+		fmt.Printf("entities-enrichment: %+v\n", config.entitiesEnrichment)
+		fmt.Printf("language-override: %+v\n", config.languageOverride)
+		fmt.Printf("profiles: %+v\n", config.profilesPath)
+		fmt.Printf("workers: %+v (max %d)\n", config.initialWorkerCount, config.maxWorkers)
+		fmt.Printf("requests: %+v\n", config.totalRequestLimit)
+		fmt.Printf("quota-reset: %+v %+v\n", config.quotaResetTime, config.quotaTimezone)
+		fmt.Printf("quota-state: %+v\n", config.quotaStatePath)
+		fmt.Printf("quota-backlog: %+v (max age %dh, penalty %d)\n", config.backlogPolicy, config.backlogMaxAge, config.backlogPriorityPenalty)
+		fmt.Printf("skipped-log: %+v\n", config.skippedLogPath)
+		fmt.Printf("shutdown-timeout: %+v\n", config.shutdownTimeout)
+		fmt.Printf("admin: %+v\n", config.adminAddr)
+		fmt.Printf("worker-stall: %+v\n", config.workerStall)
+		fmt.Printf("autoscale: %+v (%d-%d workers, %d jobs per worker, every %ds, cooldown %ds)\n",
+			config.autoscale, config.autoscaleMin, config.autoscaleMax, config.autoscaleJobsPerWorker,
+			config.autoscaleInterval, config.autoscaleCooldown)
+		fmt.Printf("mysql: %s@%s:%d/%s\n", config.mysqlUsername, config.mysqlHost, config.mysqlPort, config.mysqlDatabase)
+		fmt.Printf("mysql-pool: %d open, %d idle\n", config.mysqlMaxOpenConns, config.mysqlMaxIdleConns)
 		os.Exit(0)
 	}
 
-	if config.verbose {
-		logInfo = log.New(os.Stdout, logPrefixInfo, log.Ldate|log.Ltime)
+	config.Lock()
+	provider := config.provider
+	fallbackProvider := config.fallbackProvider
+	config.Unlock()
+	if _, ok := providers[provider]; !ok {
+		logger.Fatalf("Unknown provider %q, expected one of %s", provider, ProviderNames())
+	}
+	if _, ok := providers[fallbackProvider]; fallbackProvider != "" && !ok {
+		logger.Fatalf("Unknown fallback provider %q, expected one of %s", fallbackProvider, ProviderNames())
+	}
+
+	err = config.LoadSourceTubes()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	err = config.LoadProfiles()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	err = config.CheckAutoscale()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	config.Lock()
+	backlogPolicy := config.backlogPolicy
+	skippedLogPath := config.skippedLogPath
+	_, err = NewBacklogPolicy(backlogPolicy, config.backlogMaxAge, config.backlogPriorityPenalty)
+	config.Unlock()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	if backlogPolicy == BacklogSkip {
+		f, err := os.OpenFile(skippedLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			logger.Fatalf("Skipped log: %s", err)
+		}
+		defer f.Close()
+		logSkipped, err = NewLogger(f, logFormat, LevelInfo)
+		if err != nil {
+			logger.Fatalf("Skipped log: %s", err)
+		}
 	}
 
-	if config.debug {
-		logInfo.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-		logError.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	config.Lock()
+	q, err := NewQuota(config.totalRequestLimit, config.quotaResetTime, config.quotaTimezone, config.quotaStatePath)
+	config.Unlock()
+	if err != nil {
+		logger.Fatalf("Quota: %s", err)
 	}
+	quota = q
+	logger.Infof("%d of %d TextRazor requests used until %s", quota.Count(), quota.Limit(), quota.ResetAt())
+
+	db, err := NewMySQLPool(config)
+	if err != nil {
+		logger.Fatalf("MySQL connect failed: %s", err)
+	}
+	defer db.Close()
+	config.SetDB(db)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
-	quit := make(chan bool)
 	stack := &Stack{}
 
 	// Hook up workers here...
@@ -58,18 +161,65 @@ func main() {
 	config.Unlock()
 
 	for _, worker := range stack.Inc(c) {
-		go worker.DoWork(newWorkerConfig(config))
+		stack.Run(worker, newWorkerConfig(config))
 	}
 
-	log.Printf("Running %d workers\n", stack.Len())
+	logger.Infof("Running %d workers", stack.Len())
 
-	/*
-	   // Send kill signal over this slice of chans
-	   for _, worker := range stack.Dec(3) {
-	       worker.DieGracefully()
-	   }
-	   log.Printf("Running %d workers\n", stack.Len())
-	*/
+	config.Lock()
+	adminAddr := config.adminAddr
+	autoscale := config.autoscale
+	config.Unlock()
+
+	if autoscale {
+		go NewAutoscaler(stack, config).Run()
+	}
+
+	if adminAddr != "" {
+		go func() {
+			logger.Infof("Admin listening on %s", adminAddr)
+			logger.Fatalf("%s", http.ListenAndServe(adminAddr, NewAdminServer(stack)))
+		}()
+	}
 
-	<-quit
+	sig := <-quit
+	logger.Infof("Got %s, stopping %d workers", sig, stack.Len())
+	shutdown(stack)
+}
+
+// runCommand runs the named subcommand, given after the options,
+// instead of the daemon
+func runCommand(name string, args []string) error {
+	switch name {
+	case "buried":
+		return buried(args)
+	}
+
+	return fmt.Errorf("Unknown command %q", name)
+}
+
+// shutdown stops every worker in the stack, waiting up to
+// -shutdown-timeout for them to finish the job they hold. Any worker
+// still busy after that is abandoned; its beanstalkd connection closes
+// with the process, which releases its reserved job.
+func shutdown(stack *Stack) {
+	config.Lock()
+	timeout := time.Duration(config.shutdownTimeout) * time.Second
+	config.Unlock()
+
+	stack.Close()
+
+	done := make(chan struct{})
+	go func() {
+		stack.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Infof("All workers stopped")
+	case <-time.After(timeout):
+		logger.Errorf("Workers still busy after %s; exiting anyway", timeout)
+		os.Exit(1)
+	}
 }
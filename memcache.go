@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrCacheMiss error
+var ErrCacheMiss = errors.New("Cache miss")
+
+// MemcacheConn is a minimal memcached text protocol client supporting
+// just get and set. It is not safe for concurrent use; each worker has
+// its own. A broken connection is dropped and redialled on next use.
+type MemcacheConn struct {
+	addr    string
+	timeout time.Duration
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+}
+
+// NewMemcacheConn MemcacheConn constructor
+func NewMemcacheConn(addr string, timeout time.Duration) *MemcacheConn {
+	return &MemcacheConn{
+		addr:    addr,
+		timeout: timeout,
+	}
+}
+
+// Get method
+func (mc *MemcacheConn) Get(key string) ([]byte, error) {
+	var value []byte
+
+	err := mc.do(func() error {
+		_, err := fmt.Fprintf(mc.rw, "get %s\r\n", key)
+		if err != nil {
+			return err
+		}
+		err = mc.rw.Flush()
+		if err != nil {
+			return err
+		}
+
+		line, err := mc.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return ErrCacheMiss
+		}
+
+		var k string
+		var flags uint32
+		var n int
+		_, err = fmt.Sscanf(line, "VALUE %s %d %d", &k, &flags, &n)
+		if err != nil {
+			return fmt.Errorf("memcache get: unexpected %q", line)
+		}
+
+		value = make([]byte, n+2)
+		_, err = io.ReadFull(mc.rw, value)
+		if err != nil {
+			return err
+		}
+		value = value[:n]
+
+		line, err = mc.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "END" {
+			return fmt.Errorf("memcache get: unexpected %q", line)
+		}
+		return nil
+	})
+
+	return value, err
+}
+
+// Set method
+func (mc *MemcacheConn) Set(key string, value []byte, ttl time.Duration) error {
+	return mc.do(func() error {
+		_, err := fmt.Fprintf(mc.rw, "set %s 0 %d %d\r\n", key, int(ttl.Seconds()), len(value))
+		if err != nil {
+			return err
+		}
+		_, err = mc.rw.Write(value)
+		if err != nil {
+			return err
+		}
+		_, err = mc.rw.WriteString("\r\n")
+		if err != nil {
+			return err
+		}
+		err = mc.rw.Flush()
+		if err != nil {
+			return err
+		}
+
+		line, err := mc.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return fmt.Errorf("memcache set: %s", line)
+		}
+		return nil
+	})
+}
+
+// Close method
+func (mc *MemcacheConn) Close() {
+	if mc.conn != nil {
+		mc.conn.Close()
+		mc.conn = nil
+	}
+}
+
+// do runs op on a connection with a deadline, dialling first if needed.
+// Any error other than a cache miss leaves the connection in an unknown
+// state, so it is closed.
+func (mc *MemcacheConn) do(op func() error) error {
+	if mc.conn == nil {
+		conn, err := net.DialTimeout("tcp", mc.addr, mc.timeout)
+		if err != nil {
+			return err
+		}
+		mc.conn = conn
+		mc.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	}
+
+	mc.conn.SetDeadline(time.Now().Add(mc.timeout))
+
+	err := op()
+	if err != nil && err != ErrCacheMiss {
+		mc.Close()
+	}
+	return err
+}
+
+// readLine reads a response line without its trailing CRLF
+func (mc *MemcacheConn) readLine() (string, error) {
+	line, err := mc.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMemcached serves get and set from a map. Keys starting with "bad"
+// get a malformed reply. conns counts the connections accepted.
+type fakeMemcached struct {
+	sync.Mutex
+	ln     net.Listener
+	values map[string][]byte
+	conns  int
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fm := &fakeMemcached{ln: ln, values: make(map[string][]byte)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			fm.Lock()
+			fm.conns++
+			fm.Unlock()
+			go fm.serve(conn)
+		}
+	}()
+	return fm
+}
+
+// connCount returns the number of connections accepted so far
+func (fm *fakeMemcached) connCount() int {
+	fm.Lock()
+	defer fm.Unlock()
+	return fm.conns
+}
+
+func (fm *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+
+		fm.Lock()
+		switch {
+		case len(f) == 2 && f[0] == "get" && strings.HasPrefix(f[1], "bad"):
+			rw.WriteString("VALUE nonsense\r\n")
+		case len(f) == 2 && f[0] == "get":
+			if v, ok := fm.values[f[1]]; ok {
+				fmt.Fprintf(rw, "VALUE %s 0 %d\r\n%s\r\n", f[1], len(v), v)
+			}
+			rw.WriteString("END\r\n")
+		case len(f) == 5 && f[0] == "set":
+			var n int
+			fmt.Sscan(f[4], &n)
+			v := make([]byte, n+2)
+			io.ReadFull(rw, v)
+			fm.values[f[1]] = v[:n]
+			rw.WriteString("STORED\r\n")
+		default:
+			rw.WriteString("ERROR\r\n")
+		}
+		fm.Unlock()
+		rw.Flush()
+	}
+}
+
+func TestMemcacheConn(t *testing.T) {
+	fm := newFakeMemcached(t)
+	defer fm.ln.Close()
+
+	mc := NewMemcacheConn(fm.ln.Addr().String(), time.Second)
+	defer mc.Close()
+
+	_, err := mc.Get("missing")
+	if err != ErrCacheMiss {
+		t.Errorf("Get of a missing key: %v, want ErrCacheMiss", err)
+	}
+
+	value := []byte("gzipped\r\nEND\r\nbinary \x00\xff")
+	if err := mc.Set("article", value, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mc.Get("article")
+	if err != nil || string(got) != string(value) {
+		t.Errorf("Get = %q %v, want %q", got, err, value)
+	}
+
+	// a cache miss keeps the connection, anything else drops it
+	if n := fm.connCount(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+	if _, err := mc.Get("bad"); err == nil || err == ErrCacheMiss {
+		t.Errorf("Get of a malformed reply: %v, want an error", err)
+	}
+	if _, err := mc.Get("article"); err != nil {
+		t.Errorf("Get after an error: %v", err)
+	}
+	if n := fm.connCount(); n != 2 {
+		t.Errorf("%d connections, want 2 after redialling", n)
+	}
+}
+
+func TestMemcacheConnDown(t *testing.T) {
+	fm := newFakeMemcached(t)
+	addr := fm.ln.Addr().String()
+	fm.ln.Close()
+
+	mc := NewMemcacheConn(addr, time.Second)
+	if _, err := mc.Get("article"); err == nil || err == ErrCacheMiss {
+		t.Errorf("Get with memcached down: %v, want an error", err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency
+// histograms. TextRazor can take up to the request timeout.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// metrics is the process wide Registry served at /metrics
+var metrics = &Registry{}
+
+// Metrics, see the help text of each
+var (
+	jobsTotal = metrics.NewCounterVec("nusetextd_jobs_total",
+		"Source tube jobs by what was done with them: reserved, deleted, released or buried.", "action")
+	textRazorRequests = metrics.NewCounterVec("nusetextd_textrazor_requests_total",
+		"TextRazor requests by HTTP status code, none when no response was received.", "code")
+	cacheRequests = metrics.NewCounterVec("nusetextd_cache_requests_total",
+		"Result cache lookups by result: hit, miss or error.", "result")
+	mysqlStoreFailures = metrics.NewCounterVec("nusetextd_mysql_store_failures_total",
+		"Analyses that could not be stored in MySQL.")
+	mysqlStoreDuration = metrics.NewHistogramVec("nusetextd_mysql_store_duration_seconds",
+		"Time taken by the MySQL transaction storing an analysis.", latencyBuckets)
+	stageDuration = metrics.NewHistogramVec("nusetextd_stage_duration_seconds",
+		"Time taken by each stage of a worker loop: reserve, analyse, store or publish.", latencyBuckets, "stage")
+)
+
+// metric is a metric family written in the Prometheus text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry is a minimal Prometheus registry of counters and histograms.
+// Gauges are read from their source when scraped; see writeSample.
+type Registry struct {
+	sync.Mutex
+	metrics []metric
+}
+
+// NewCounterVec registers a CounterVec
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+	r.register(c)
+	return c
+}
+
+// NewHistogramVec registers a HistogramVec
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+// Write writes every registered metric
+func (r *Registry) Write(w io.Writer) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, m := range r.metrics {
+		m.write(w)
+	}
+}
+
+func (r *Registry) register(m metric) {
+	r.Lock()
+	defer r.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+// Inc adds one to the counter with the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[labelKey(labelValues)]++
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key, "", 0), formatFloat(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	sync.Mutex
+	name       string
+	help       string
+	labels     []string
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+// histogram holds the observations of one HistogramVec label set
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Observe records d in the histogram with the given label values
+func (h *HistogramVec) Observe(d time.Duration, labelValues ...string) {
+	h.Lock()
+	defer h.Unlock()
+
+	key := labelKey(labelValues)
+	hist, ok := h.histograms[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+	}
+
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += v
+	hist.count++
+}
+
+// Since records the time elapsed since start
+func (h *HistogramVec) Since(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start), labelValues...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+
+	keys := make([]string, 0, len(h.histograms))
+	for key := range h.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range keys {
+		hist := h.histograms[key]
+
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", math.Inf(1)), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, "", 0), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, "", 0), hist.count)
+	}
+}
+
+// writeSample writes a metric family with a single unlabelled sample,
+// for values read from elsewhere when scraped
+func writeSample(w io.Writer, name, help, typ string, value float64) {
+	writeHeader(w, name, help, typ)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// labelSep separates label values in a label key; it can't appear in
+// valid UTF-8
+const labelSep = "\xff"
+
+func labelKey(labelValues []string) string {
+	return strings.Join(labelValues, labelSep)
+}
+
+// formatLabels formats the label set of key, with the extra label if
+// one is named, e.g. {stage="analyse",le="0.5"}
+func formatLabels(labels []string, key, extra string, extraValue float64) string {
+	var pairs []string
+	if len(labels) > 0 {
+		for i, value := range strings.Split(key, labelSep) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], value))
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra, formatFloat(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
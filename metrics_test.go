@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := &Registry{}
+	jobs := r.NewCounterVec("test_jobs_total", "Jobs by action.", "action")
+	failures := r.NewCounterVec("test_failures_total", "Failures.")
+	latency := r.NewHistogramVec("test_duration_seconds", "Latency by stage.", []float64{0.1, 1}, "stage")
+
+	jobs.Inc("reserved")
+	jobs.Inc("reserved")
+	jobs.Inc(`say "hi"`)
+	failures.Inc()
+	latency.Observe(50*time.Millisecond, "analyse")
+	latency.Observe(500*time.Millisecond, "analyse")
+	latency.Observe(2*time.Second, "analyse")
+	latency.Observe(100*time.Millisecond, "store")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	writeSample(&buf, "test_workers", "Workers running.", "gauge", 3)
+
+	want := `# HELP test_jobs_total Jobs by action.
+# TYPE test_jobs_total counter
+test_jobs_total{action="reserved"} 2
+test_jobs_total{action="say \"hi\""} 1
+# HELP test_failures_total Failures.
+# TYPE test_failures_total counter
+test_failures_total 1
+# HELP test_duration_seconds Latency by stage.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{stage="analyse",le="0.1"} 1
+test_duration_seconds_bucket{stage="analyse",le="1"} 2
+test_duration_seconds_bucket{stage="analyse",le="+Inf"} 3
+test_duration_seconds_sum{stage="analyse"} 2.55
+test_duration_seconds_count{stage="analyse"} 3
+test_duration_seconds_bucket{stage="store",le="0.1"} 1
+test_duration_seconds_bucket{stage="store",le="1"} 1
+test_duration_seconds_bucket{stage="store",le="+Inf"} 1
+test_duration_seconds_sum{stage="store"} 0.1
+test_duration_seconds_count{stage="store"} 1
+# HELP test_workers Workers running.
+# TYPE test_workers gauge
+test_workers 3
+`
+	if buf.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestRegistryWriteEmpty(t *testing.T) {
+	r := &Registry{}
+	r.NewCounterVec("test_jobs_total", "Jobs by action.", "action")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	want := "# HELP test_jobs_total Jobs by action.\n# TYPE test_jobs_total counter\n"
+	if buf.String() != want {
+		t.Errorf("Write() = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// MySQLDSN returns the go-sql-driver DSN for the configured MySQL server
+func (c *NusefeedConfig) MySQLDSN() string {
+	c.Lock()
+	defer c.Unlock()
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", c.mysqlUsername, c.mysqlPassword, c.mysqlHost, c.mysqlPort, c.mysqlDatabase)
+}
+
+// NewMySQLPool opens the process wide MySQL connection pool and pings
+// it, so an unreachable server is reported at startup rather than on
+// the first article
+func NewMySQLPool(c *NusefeedConfig) (*sql.DB, error) {
+	db, err := sql.Open("mysql", c.MySQLDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	db.SetMaxOpenConns(c.mysqlMaxOpenConns)
+	db.SetMaxIdleConns(c.mysqlMaxIdleConns)
+	addr := fmt.Sprintf("%s:%d/%s", c.mysqlHost, c.mysqlPort, c.mysqlDatabase)
+	c.Unlock()
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("MySQL %s unreachable: %s", addr, err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// quota is the process wide daily TextRazor request quota, set up by main
+var quota *Quota
+
+// Quota counts TextRazor requests against a daily limit which resets at
+// a fixed time of day. The count is saved to a state file after every
+// request so a restart, or a crash loop, can't exceed the limit.
+type Quota struct {
+	sync.Mutex
+	limit       int
+	count       int
+	resetAt     time.Time
+	resetHour   int
+	resetMinute int
+	loc         *time.Location
+	statePath   string
+}
+
+// quotaState is the JSON saved to the state file
+type quotaState struct {
+	Count   int       `json:"count"`
+	ResetAt time.Time `json:"resetAt"`
+}
+
+// NewQuota Quota constructor. resetTime is "HH:MM" in the timezone tz.
+// Any count saved in statePath for the current window is restored.
+func NewQuota(limit int, resetTime, tz, statePath string) (*Quota, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("Bad quota timezone %q: %s", tz, err)
+	}
+
+	t, err := time.Parse("15:04", resetTime)
+	if err != nil {
+		return nil, fmt.Errorf("Bad quota reset time %q: %s", resetTime, err)
+	}
+
+	q := &Quota{
+		limit:       limit,
+		resetHour:   t.Hour(),
+		resetMinute: t.Minute(),
+		loc:         loc,
+		statePath:   statePath,
+	}
+	q.resetAt = q.nextReset(time.Now())
+
+	err = q.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Take uses one request from the quota, or returns ErrRequestLimitMet.
+// It logs through log, the Logger of the job taking the request.
+func (q *Quota) Take(log *Logger) error {
+	q.Lock()
+	defer q.Unlock()
+
+	q.rollover(log)
+	if q.count >= q.limit {
+		return ErrRequestLimitMet
+	}
+	q.count++
+
+	err := q.save()
+	if err != nil {
+		log.Errorf("Quota state: %s", err)
+	}
+
+	return nil
+}
+
+// Count method
+func (q *Quota) Count() int {
+	q.Lock()
+	defer q.Unlock()
+
+	q.rollover(logger)
+	return q.count
+}
+
+// Limit method
+func (q *Quota) Limit() int {
+	return q.limit
+}
+
+// Remaining method
+func (q *Quota) Remaining() int {
+	q.Lock()
+	defer q.Unlock()
+
+	q.rollover(logger)
+	if q.count >= q.limit {
+		return 0
+	}
+	return q.limit - q.count
+}
+
+// ResetAt returns when the current quota window ends
+func (q *Quota) ResetAt() time.Time {
+	q.Lock()
+	defer q.Unlock()
+
+	q.rollover(logger)
+	return q.resetAt
+}
+
+// rollover starts a new window once the reset time has passed.
+// Must be called with the lock held.
+func (q *Quota) rollover(log *Logger) {
+	now := time.Now()
+	if now.Before(q.resetAt) {
+		return
+	}
+
+	log.Infof("Quota reset; %d of %d requests used", q.count, q.limit)
+	q.count = 0
+	q.resetAt = q.nextReset(now)
+
+	err := q.save()
+	if err != nil {
+		log.Errorf("Quota state: %s", err)
+	}
+}
+
+// nextReset returns the first reset time after now
+func (q *Quota) nextReset(now time.Time) time.Time {
+	now = now.In(q.loc)
+	reset := time.Date(now.Year(), now.Month(), now.Day(), q.resetHour, q.resetMinute, 0, 0, q.loc)
+	if !reset.After(now) {
+		reset = reset.AddDate(0, 0, 1)
+	}
+	return reset
+}
+
+// load restores the count from the state file, if it was saved during
+// the current window
+func (q *Quota) load() error {
+	if q.statePath == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(q.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state quotaState
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return fmt.Errorf("Bad quota state file %s: %s", q.statePath, err)
+	}
+
+	if state.ResetAt.Equal(q.resetAt) {
+		q.count = state.Count
+	}
+
+	return nil
+}
+
+// save writes the state file via a rename so it is never left half
+// written. Must be called with the lock held.
+func (q *Quota) save() error {
+	if q.statePath == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(&quotaState{Count: q.count, ResetAt: q.resetAt})
+	if err != nil {
+		return err
+	}
+
+	tmp := q.statePath + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, q.statePath)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQuotaNextReset(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	q := &Quota{resetHour: 0, resetMinute: 30, loc: cet}
+
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2017, 3, 14, 0, 29, 59, 0, cet), time.Date(2017, 3, 14, 0, 30, 0, 0, cet)},
+		{time.Date(2017, 3, 14, 0, 30, 0, 0, cet), time.Date(2017, 3, 15, 0, 30, 0, 0, cet)},
+		{time.Date(2017, 3, 14, 23, 0, 0, 0, cet), time.Date(2017, 3, 15, 0, 30, 0, 0, cet)},
+		{time.Date(2017, 12, 31, 12, 0, 0, 0, cet), time.Date(2018, 1, 1, 0, 30, 0, 0, cet)},
+		// 23:15 UTC is already 00:15 the next day in CET
+		{time.Date(2017, 3, 14, 23, 15, 0, 0, time.UTC), time.Date(2017, 3, 15, 0, 30, 0, 0, cet)},
+		{time.Date(2017, 3, 14, 23, 45, 0, 0, time.UTC), time.Date(2017, 3, 16, 0, 30, 0, 0, cet)},
+	}
+
+	for _, test := range tests {
+		if got := q.nextReset(test.now); !got.Equal(test.want) {
+			t.Errorf("nextReset(%s) = %s, want %s", test.now, got, test.want)
+		}
+	}
+}
+
+func TestNewQuotaBadConfig(t *testing.T) {
+	if _, err := NewQuota(100, "25:00", "UTC", ""); err == nil {
+		t.Error("no error for a bad reset time")
+	}
+	if _, err := NewQuota(100, "00:00", "Nowhere/Special", ""); err == nil {
+		t.Error("no error for a bad timezone")
+	}
+}
+
+// tempQuotaState returns the path of a state file in a new temporary
+// directory, and a func removing it
+func tempQuotaState(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "quota.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestQuotaTakeAndLoad(t *testing.T) {
+	path, cleanup := tempQuotaState(t)
+	defer cleanup()
+
+	q, err := NewQuota(3, "00:00", "UTC", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := q.Take(logger); err != nil {
+			t.Fatalf("Take %d: %s", i+1, err)
+		}
+	}
+	if err := q.Take(logger); err != ErrRequestLimitMet {
+		t.Fatalf("Take over the limit = %v, want ErrRequestLimitMet", err)
+	}
+	if q.Remaining() != 0 {
+		t.Errorf("Remaining() = %d, want 0", q.Remaining())
+	}
+
+	// a restart in the same window carries on from the saved count
+	restarted, err := NewQuota(3, "00:00", "UTC", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Count() != 3 {
+		t.Errorf("restored Count() = %d, want 3", restarted.Count())
+	}
+}
+
+func TestQuotaLoad(t *testing.T) {
+	path, cleanup := tempQuotaState(t)
+	defer cleanup()
+
+	q := &Quota{
+		limit:     100,
+		resetAt:   time.Date(2017, 3, 15, 0, 0, 0, 0, time.UTC),
+		statePath: path,
+	}
+
+	// no state file yet
+	if err := q.load(); err != nil || q.count != 0 {
+		t.Errorf("load() without a file: count %d, %v", q.count, err)
+	}
+
+	// saved in an earlier window
+	ioutil.WriteFile(path, []byte(`{"count":42,"resetAt":"2017-03-14T00:00:00Z"}`), 0644)
+	if err := q.load(); err != nil || q.count != 0 {
+		t.Errorf("load() of an old window: count %d, %v", q.count, err)
+	}
+
+	// saved in this window, in another timezone
+	ioutil.WriteFile(path, []byte(`{"count":42,"resetAt":"2017-03-15T01:00:00+01:00"}`), 0644)
+	if err := q.load(); err != nil || q.count != 42 {
+		t.Errorf("load() of this window: count %d, %v; want 42", q.count, err)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"count":`), 0644)
+	if err := q.load(); err == nil {
+		t.Error("no error loading a truncated file")
+	}
+}
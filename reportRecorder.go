@@ -2,26 +2,44 @@ package main
 
 import (
 	"database/sql"
-	"fmt"
-
-	_ "github.com/go-sql-driver/mysql"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// ReportRecorder stores an TextRazorResult in a MySQL table
+// ReportRecorder stores an Analysis in a MySQL table
 type ReportRecorder struct {
 	db *sql.DB
 }
 
-// NewReportRecorder is a ReportRecorder constructor
-func NewReportRecorder(mysqlHost, mysqlUsername, mysqlPassword string) *ReportRecorder {
-	return &ReportRecorder{}
+// NewReportRecorder is a ReportRecorder constructor. The db pool is shared
+// between all workers and is owned by main.
+func NewReportRecorder(db *sql.DB) *ReportRecorder {
+	return &ReportRecorder{
+		db: db,
+	}
 }
 
-// StoreTopics If there is an error executing any of the inserts, all pervious inserts
-// for this TextRazorResult is reolledback, ensuring we dont have a partial
-// TextRazorResult written to the database.
-func (rr *ReportRecorder) StoreTopics(r *TextRazorResult) error {
-	// Should be able to get the article url from the TextRazorResult
+// Store writes the article, its topics, coarse topics, entities and the
+// archived provider response in a single transaction. If there is an
+// error executing any of the inserts, all pervious inserts for this
+// Analysis is reolledback, ensuring we dont have a partial Analysis
+// written to the database.
+func (rr *ReportRecorder) Store(au *ArticleURL, a *Analysis) error {
+	start := time.Now()
+	err := rr.store(au, a)
+	mysqlStoreDuration.Since(start)
+	if err != nil {
+		mysqlStoreFailures.Inc()
+	}
+
+	return err
+}
+
+func (rr *ReportRecorder) store(au *ArticleURL, a *Analysis) error {
+	// Should be able to get the article url from the Analysis
 	// write this into MySQL linking table:
 	//
 	// | articleURLHash | articleUrl |
@@ -30,66 +48,279 @@ func (rr *ReportRecorder) StoreTopics(r *TextRazorResult) error {
 	//
 	// | TopicHash | Label |
 	//
+	// and likewise for entities
+
+	tx, err := rr.db.Begin()
+	if err != nil {
+		return err
+	}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", "nusetext", "10rapid", "163.172.149.161", "nuseagent")
-	db, err := sql.Open("mysql", dsn)
+	articleURLHash := generateHash(a.URL)
+
+	err = rr.StoreArticle(tx, articleURLHash, au.Meta, a)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	defer db.Close()
 
-	err = db.Ping()
+	err = rr.StoreTopics(tx, articleURLHash, a)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	tx, err := db.Begin()
+	err = rr.StoreCoarseTopics(tx, articleURLHash, a)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	stmtArticles, err := tx.Prepare("INSERT IGNORE INTO articles (url) VALUES( ? )") // ? = placeholder
+	err = rr.StoreEntities(tx, articleURLHash, a)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	defer stmtArticles.Close()
 
-	stmtTopics, err := tx.Prepare("INSERT IGNORE INTO topics (label, score, wikiLink, wikidataId) VALUES( ?, ?, ?, ? )") // ? = placeholder
+	err = rr.StoreAnalysis(tx, articleURLHash, a)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// StoreArticle inserts the article row within tx, with the feed details
+// of its job. The details of a later job for the same article replace
+// them, except where that job leaves them out.
+func (rr *ReportRecorder) StoreArticle(tx *sql.Tx, articleURLHash string, meta *ArticleJob, a *Analysis) error {
+	var feedID sql.NullInt64
+	var feedTitle, traceID sql.NullString
+	if meta.FeedID != 0 {
+		feedID = sql.NullInt64{Int64: meta.FeedID, Valid: true}
+	}
+	if meta.FeedTitle != "" {
+		feedTitle = sql.NullString{String: meta.FeedTitle, Valid: true}
+	}
+	if meta.TraceID != "" {
+		traceID = sql.NullString{String: meta.TraceID, Valid: true}
+	}
+
+	_, err := tx.Exec("INSERT INTO articles (hash, url, feedId, feedTitle, publishedAt, traceId) VALUES( ?, ?, ?, ?, ?, ? ) "+
+		"ON DUPLICATE KEY UPDATE feedId = IFNULL(VALUES(feedId), feedId), feedTitle = IFNULL(VALUES(feedTitle), feedTitle), "+
+		"publishedAt = IFNULL(VALUES(publishedAt), publishedAt), traceId = IFNULL(VALUES(traceId), traceId)", // ? = placeholder
+		articleURLHash,
+		a.URL,
+		feedID,
+		feedTitle,
+		meta.Published,
+		traceID,
+	)
+	return err
+}
+
+// StoreTopics inserts the topics of a and links them to the article within tx
+func (rr *ReportRecorder) StoreTopics(tx *sql.Tx, articleURLHash string, a *Analysis) error {
+	stmtTopics, err := tx.Prepare("INSERT IGNORE INTO topics (hash, label, score, wikiLink, wikidataId) VALUES( ?, ?, ?, ?, ? )") // ? = placeholder
 	if err != nil {
 		return err
 	}
 	defer stmtTopics.Close()
 
-	stmtArticlesHasTopics, err := tx.Prepare("INSERT IGNORE INTO article_has_topics (articleHash, topicHash) VALUES( ?, ? )") // ? = placeholder
+	stmtArticlesHasTopics, err := tx.Prepare("INSERT INTO article_has_topics (articleHash, topicHash, provider) VALUES( ?, ?, ? ) " +
+		"ON DUPLICATE KEY UPDATE provider = VALUES(provider)") // ? = placeholder
 	if err != nil {
 		return err
 	}
 	defer stmtArticlesHasTopics.Close()
 
-	for _, topic := range r.Response.Topics {
+	for _, topic := range a.Topics {
 
-		articleURLHash := generateHash(r.URL)
 		topicHash := generateHash(topic.Label)
 
-		_, err = stmtArticles.Exec(articleURLHash, r.URL)
+		_, err = stmtTopics.Exec(topicHash, topic.Label, topic.Score, topic.WikiLink, topic.WikidataID)
+		if err != nil {
+			return err
+		}
+
+		_, err = stmtArticlesHasTopics.Exec(articleURLHash, topicHash, a.Provider)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StoreCoarseTopics inserts the coarse topics of a and links them to the article within tx
+func (rr *ReportRecorder) StoreCoarseTopics(tx *sql.Tx, articleURLHash string, a *Analysis) error {
+	stmtCoarseTopics, err := tx.Prepare("INSERT IGNORE INTO coarse_topics (hash, label, wikiLink, wikidataId) VALUES( ?, ?, ?, ? )") // ? = placeholder
+	if err != nil {
+		return err
+	}
+	defer stmtCoarseTopics.Close()
+
+	stmtArticlesHasCoarseTopics, err := tx.Prepare("INSERT INTO article_has_coarse_topics (articleHash, coarseTopicHash, score, provider) VALUES( ?, ?, ?, ? ) " +
+		"ON DUPLICATE KEY UPDATE score = VALUES(score), provider = VALUES(provider)") // ? = placeholder
+	if err != nil {
+		return err
+	}
+	defer stmtArticlesHasCoarseTopics.Close()
+
+	for _, topic := range a.CoarseTopics {
+
+		coarseTopicHash := generateHash(topic.Label)
+
+		_, err = stmtCoarseTopics.Exec(coarseTopicHash, topic.Label, topic.WikiLink, topic.WikidataID)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 
-		_, err = stmtTopics.Exec(topicHash, topic.Label, topic.Score, topic.WikiLink, topic.ID)
+		_, err = stmtArticlesHasCoarseTopics.Exec(articleURLHash, coarseTopicHash, topic.Score, a.Provider)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
+	}
+
+	return nil
+}
+
+// StoreAnalysis archives the gzipped raw provider response for the
+// article within tx, so new tables can be derived later without
+// re-requesting the analysis. A re-analysed article replaces its archive.
+func (rr *ReportRecorder) StoreAnalysis(tx *sql.Tx, articleURLHash string, a *Analysis) error {
+	response, err := gzipBytes(a.Raw)
+	if err != nil {
+		return err
+	}
 
-		_, err = stmtArticlesHasTopics.Exec(articleURLHash, topicHash)
+	// The fetch columns are NULL when the provider downloaded the article
+	var fetchStatus, contentLength sql.NullInt64
+	var fetchedURL sql.NullString
+	if a.Fetch != nil {
+		fetchStatus = sql.NullInt64{Int64: int64(a.Fetch.Status), Valid: true}
+		fetchedURL = sql.NullString{String: a.Fetch.FinalURL, Valid: true}
+		contentLength = sql.NullInt64{Int64: int64(a.Fetch.ContentLength), Valid: true}
+	}
+
+	_, err = tx.Exec("REPLACE INTO article_analyses (articleHash, provider, analysedAt, language, languageIsReliable, sentenceCount, fetchStatus, fetchedUrl, contentLength, response) VALUES( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )", // ? = placeholder
+		articleURLHash,
+		a.Provider,
+		a.AnalysedAt,
+		a.Language,
+		a.LanguageIsReliable,
+		len(a.Sentences),
+		fetchStatus,
+		fetchedURL,
+		contentLength,
+		response,
+	)
+	return err
+}
+
+// StoreEntities inserts the entities of a and links them to the article
+// within tx. Entities are keyed by their entity id, so the same text
+// naming different entities is kept apart; what the article says about
+// an entity, its confidence, relevance and mentions, goes on the link.
+func (rr *ReportRecorder) StoreEntities(tx *sql.Tx, articleURLHash string, a *Analysis) error {
+	stmtEntities, err := tx.Prepare("INSERT IGNORE INTO entities " +
+		"(hash, entityId, entityEnglishId, `type`, freebaseTypes, freebaseId, wikidataId, `data`, wikiLink) " +
+		"VALUES( ?, ?, ?, ?, ?, ?, ?, ?, ? )") // ? = placeholder
+	if err != nil {
+		return err
+	}
+	defer stmtEntities.Close()
+
+	stmtArticlesHasEntities, err := tx.Prepare("REPLACE INTO article_has_entities " +
+		"(articleHash, entityHash, provider, confidenceScore, relevanceScore, matchedText, matchingTokens) " +
+		"VALUES( ?, ?, ?, ?, ?, ?, ? )") // ? = placeholder
+	if err != nil {
+		return err
+	}
+	defer stmtArticlesHasEntities.Close()
+
+	for _, entity := range mergeMentions(a.Entities) {
+
+		entityHash := generateHash(entityKey(entity))
+
+		var data []byte
+		if entity.Data != nil {
+			data, err = json.Marshal(entity.Data)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = stmtEntities.Exec(
+			entityHash,
+			entity.ID,
+			entity.EnglishID,
+			strings.Join(entity.Types, ","),
+			strings.Join(entity.FreebaseTypes, ","),
+			entity.FreebaseID,
+			entity.WikidataID,
+			data,
+			entity.WikiLink,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = stmtArticlesHasEntities.Exec(
+			articleURLHash,
+			entityHash,
+			a.Provider,
+			entity.Confidence,
+			entity.Relevance,
+			entity.MatchedText,
+			joinInts(entity.MatchingTokens),
+		)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
 
-	tx.Commit()
 	return nil
 }
+
+// entityKey is what an entity is hashed by: its entity id, or for
+// providers without one its matched text
+func entityKey(e Entity) string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.MatchedText
+}
+
+// mergeMentions merges the entities mentioned more than once, as
+// TextRazor lists each mention, keeping the first matched text, the
+// highest scores and every matching token
+func mergeMentions(entities []Entity) []Entity {
+	var merged []Entity
+	index := make(map[string]int)
+	for _, e := range entities {
+		i, ok := index[entityKey(e)]
+		if !ok {
+			index[entityKey(e)] = len(merged)
+			e.MatchingTokens = append([]int(nil), e.MatchingTokens...)
+			merged = append(merged, e)
+			continue
+		}
+
+		m := &merged[i]
+		m.Confidence = math.Max(m.Confidence, e.Confidence)
+		m.Relevance = math.Max(m.Relevance, e.Relevance)
+		m.MatchingTokens = append(m.MatchingTokens, e.MatchingTokens...)
+	}
+
+	return merged
+}
+
+// joinInts returns ints as a comma separated list
+func joinInts(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
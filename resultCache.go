@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// memcacheTimeout bounds each memcached round trip
+const memcacheTimeout = 1 * time.Second
+
+// maxCacheTTL is the longest relative expiry memcached accepts; anything
+// longer is taken as a unix timestamp
+const maxCacheTTL = 30 * 24 * time.Hour
+
+// ResultCache stores Analyses in memcached, gzipped JSON keyed by the
+// ArticleURL Hash and the variant of analysis, e.g. its provider and
+// extractor profile
+type ResultCache struct {
+	mc  *MemcacheConn
+	ttl time.Duration
+}
+
+// NewResultCache ResultCache constructor
+func NewResultCache(host string, ttl, timeout time.Duration) *ResultCache {
+	if ttl > maxCacheTTL {
+		ttl = maxCacheTTL
+	}
+
+	return &ResultCache{
+		mc:  NewMemcacheConn(host, timeout),
+		ttl: ttl,
+	}
+}
+
+// Get returns the cached Analysis variant of au, or ErrCacheMiss
+func (rc *ResultCache) Get(au *ArticleURL, variant string) (*Analysis, error) {
+	b, err := rc.mc.Get(cacheKey(au, variant))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = gunzipBytes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var a Analysis
+	err = json.Unmarshal(b, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Set method
+func (rc *ResultCache) Set(au *ArticleURL, variant string, a *Analysis) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	b, err = gzipBytes(b)
+	if err != nil {
+		return err
+	}
+
+	return rc.mc.Set(cacheKey(au, variant), b, rc.ttl)
+}
+
+// cacheKey is the memcached key of the variant of au; the variant is
+// hashed as it may hold characters memcached keys cannot
+func cacheKey(au *ArticleURL, variant string) string {
+	return au.Hash + "_" + generateHash(variant)
+}
+
+// Close method
+func (rc *ResultCache) Close() {
+	rc.mc.Close()
+}
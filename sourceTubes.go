@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// source tube order constants
+const (
+	TubeOrderPriority string = "priority" // always try the tubes in the order listed
+	TubeOrderWeighted string = "weighted" // try the tubes in a random order biased by weight
+)
+
+// SourceTube is a tube articles are reserved from
+type SourceTube struct {
+	Name   string
+	Weight int
+}
+
+// ParseSourceTubes parses a -src-tube list, e.g. "breaking:5,articles".
+// Weights default to 1.
+func ParseSourceTubes(s string) ([]SourceTube, error) {
+	var tubes []SourceTube
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+
+		st := SourceTube{Name: t, Weight: 1}
+		if i := strings.LastIndex(t, ":"); i >= 0 {
+			w, err := strconv.Atoi(t[i+1:])
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("Bad weight for source tube %q", t)
+			}
+			st = SourceTube{Name: t[:i], Weight: w}
+		}
+
+		if seen[st.Name] {
+			return nil, fmt.Errorf("Source tube %s listed twice", st.Name)
+		}
+		seen[st.Name] = true
+		tubes = append(tubes, st)
+	}
+
+	if len(tubes) == 0 {
+		return nil, fmt.Errorf("No source tubes in %q", s)
+	}
+
+	return tubes, nil
+}
+
+// sourceTubeNames returns the names of tubes
+func sourceTubeNames(tubes []SourceTube) []string {
+	names := make([]string, len(tubes))
+	for i, t := range tubes {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// TubeSchedule decides the order the source tubes are tried in for
+// each reserve
+type TubeSchedule struct {
+	tubes []SourceTube
+	order string
+}
+
+// NewTubeSchedule TubeSchedule constructor
+func NewTubeSchedule(tubes []SourceTube, order string) (*TubeSchedule, error) {
+	switch order {
+	case TubeOrderPriority, TubeOrderWeighted:
+	default:
+		return nil, fmt.Errorf("Unknown source tube order %q", order)
+	}
+
+	return &TubeSchedule{
+		tubes: tubes,
+		order: order,
+	}, nil
+}
+
+// Tubes returns the names of every source tube
+func (ts *TubeSchedule) Tubes() []string {
+	return sourceTubeNames(ts.tubes)
+}
+
+// Order returns the source tubes in the order to try them. Weighted
+// orders are drawn without replacement, so a tube of weight 3 comes
+// before a tube of weight 1 three times out of four.
+func (ts *TubeSchedule) Order() []string {
+	if ts.order == TubeOrderPriority || len(ts.tubes) == 1 {
+		return ts.Tubes()
+	}
+
+	remaining := make([]SourceTube, len(ts.tubes))
+	copy(remaining, ts.tubes)
+	total := 0
+	for _, t := range remaining {
+		total += t.Weight
+	}
+
+	order := make([]string, 0, len(remaining))
+	for len(remaining) > 0 {
+		n := rand.Intn(total)
+		i := 0
+		for n >= remaining[i].Weight {
+			n -= remaining[i].Weight
+			i++
+		}
+
+		order = append(order, remaining[i].Name)
+		total -= remaining[i].Weight
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+
+	return order
+}
+
+// tubeStats counts the articles from each source tube
+var tubeStats = &TubeStats{
+	tubes: make(map[string]*TubeCounts),
+}
+
+// TubeCounts counts the articles reserved from a source tube and what
+// became of them. Articles put back while the quota is exhausted are
+// neither analysed nor failed.
+type TubeCounts struct {
+	Reserved int `json:"reserved"`
+	Analysed int `json:"analysed"`
+	Failed   int `json:"failed"`
+}
+
+// TubeStats holds the TubeCounts of every source tube
+type TubeStats struct {
+	sync.Mutex
+	tubes map[string]*TubeCounts
+}
+
+// Reserved method
+func (ts *TubeStats) Reserved(tube string) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.counts(tube).Reserved++
+}
+
+// Analysed method
+func (ts *TubeStats) Analysed(tube string) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.counts(tube).Analysed++
+}
+
+// Failed method
+func (ts *TubeStats) Failed(tube string) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.counts(tube).Failed++
+}
+
+// Snapshot returns a copy of the counts of every tube seen so far
+func (ts *TubeStats) Snapshot() map[string]TubeCounts {
+	ts.Lock()
+	defer ts.Unlock()
+
+	snapshot := make(map[string]TubeCounts, len(ts.tubes))
+	for tube, c := range ts.tubes {
+		snapshot[tube] = *c
+	}
+	return snapshot
+}
+
+// counts returns the TubeCounts of tube, which must be locked
+func (ts *TubeStats) counts(tube string) *TubeCounts {
+	c, ok := ts.tubes[tube]
+	if !ok {
+		c = &TubeCounts{}
+		ts.tubes[tube] = c
+	}
+	return c
+}
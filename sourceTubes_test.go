@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseSourceTubes(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []SourceTube
+	}{
+		{"articles", []SourceTube{{"articles", 1}}},
+		{"breaking:5,articles", []SourceTube{{"breaking", 5}, {"articles", 1}}},
+		{" breaking:3 , articles ,", []SourceTube{{"breaking", 3}, {"articles", 1}}},
+		{"a:b:2", []SourceTube{{"a:b", 2}}},
+	}
+	for _, test := range tests {
+		got, err := ParseSourceTubes(test.s)
+		if err != nil {
+			t.Errorf("ParseSourceTubes(%q): %s", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSourceTubes(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", " , ", "articles:0", "articles:-1", "articles:x", "articles:", "a,b,a", "a:2,a:3"} {
+		got, err := ParseSourceTubes(s)
+		if err == nil {
+			t.Errorf("ParseSourceTubes(%q) = %v, want an error", s, got)
+		}
+	}
+}
+
+func TestNewTubeScheduleBadOrder(t *testing.T) {
+	_, err := NewTubeSchedule([]SourceTube{{"articles", 1}}, "random")
+	if err == nil {
+		t.Error("no error for an unknown order")
+	}
+}
+
+func TestTubeSchedulePriorityOrder(t *testing.T) {
+	ts, err := NewTubeSchedule([]SourceTube{{"breaking", 5}, {"articles", 1}, {"archive", 1}}, TubeOrderPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"breaking", "articles", "archive"}
+	for i := 0; i < 10; i++ {
+		if got := ts.Order(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Order() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTubeScheduleWeightedOrder(t *testing.T) {
+	ts, err := NewTubeSchedule([]SourceTube{{"breaking", 3}, {"articles", 1}, {"archive", 1}}, TubeOrderWeighted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20000
+	first := make(map[string]int)
+	for i := 0; i < n; i++ {
+		order := ts.Order()
+
+		sorted := append([]string(nil), order...)
+		sort.Strings(sorted)
+		if !reflect.DeepEqual(sorted, []string{"archive", "articles", "breaking"}) {
+			t.Fatalf("Order() = %v, want each tube once", order)
+		}
+		first[order[0]]++
+	}
+
+	// breaking has 3 of the 5 weight, so comes first 60% of the time
+	want := map[string]float64{"breaking": 0.6, "articles": 0.2, "archive": 0.2}
+	for tube, p := range want {
+		got := float64(first[tube]) / n
+		if got < p-0.03 || got > p+0.03 {
+			t.Errorf("%s first %.3f of the time, want about %.1f", tube, got, p)
+		}
+	}
+}
+
+func TestTubeScheduleSingleTube(t *testing.T) {
+	ts, err := NewTubeSchedule([]SourceTube{{"articles", 4}}, TubeOrderWeighted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ts.Order(); !reflect.DeepEqual(got, []string{"articles"}) {
+		t.Errorf("Order() = %v, want [articles]", got)
+	}
+}
@@ -1,11 +1,20 @@
 package main
 
-import "sync"
+import (
+	"errors"
+	"sync"
+)
+
+// ErrStackClosed error
+var ErrStackClosed = errors.New("Worker stack closed")
 
 // Stack struct
 type Stack struct {
 	sync.Mutex
-	stack []Worker
+	stack    []Worker
+	running  sync.WaitGroup
+	resizing sync.Mutex
+	closed   bool
 }
 
 // Inc method
@@ -28,13 +37,16 @@ func (s *Stack) Dec(count int) []Worker {
 	s.Lock()
 	defer s.Unlock()
 
+	if count > len(s.stack) {
+		count = len(s.stack)
+	}
 	pos := len(s.stack) - count
 
 	n := make([]Worker, count)
 	copy(n, s.stack[pos:])
 
 	for i := range s.stack[pos:] {
-		s.stack[i] = nil
+		s.stack[pos+i] = nil
 	}
 	s.stack = s.stack[:pos]
 
@@ -48,3 +60,54 @@ func (s *Stack) Len() int {
 
 	return len(s.stack)
 }
+
+// Run starts w working in its own goroutine, tracking it until it returns
+func (s *Stack) Run(w Worker, c *WorkerConfig) {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		w.DoWork(c)
+	}()
+}
+
+// Wait blocks until every worker started with Run has returned
+func (s *Stack) Wait() {
+	s.running.Wait()
+}
+
+// Resize grows or shrinks the stack to count workers. New workers are
+// Run with a config from newConfig; removed workers are told to
+// DieGracefully, so they stop once their current job is done.
+func (s *Stack) Resize(count int, newConfig func() *WorkerConfig) error {
+	s.resizing.Lock()
+	defer s.resizing.Unlock()
+
+	if s.closed {
+		return ErrStackClosed
+	}
+
+	current := s.Len()
+	switch {
+	case count > current:
+		for _, worker := range s.Inc(count - current) {
+			s.Run(worker, newConfig())
+		}
+	case count < current:
+		for _, worker := range s.Dec(current - count) {
+			worker.DieGracefully()
+		}
+	}
+
+	return nil
+}
+
+// Close tells every worker to DieGracefully and stops any further Resize
+func (s *Stack) Close() {
+	s.resizing.Lock()
+	defer s.resizing.Unlock()
+
+	s.closed = true
+	for _, worker := range s.Dec(s.Len()) {
+		worker.DieGracefully()
+	}
+}
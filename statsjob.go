@@ -2,7 +2,12 @@ package main
 
 // StatsJob struct
 type StatsJob struct {
-	TTR   int
-	Pri   int
-	Delay int
+	TTR      int
+	Pri      int
+	Delay    int
+	Age      int
+	Releases int
+	Buries   int
+	State    string
+	Tube     string
 }
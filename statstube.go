@@ -0,0 +1,13 @@
+package main
+
+// StatsTube struct
+type StatsTube struct {
+	Name                string `yaml:"name"`
+	CurrentJobsUrgent   int    `yaml:"current-jobs-urgent"`
+	CurrentJobsReady    int    `yaml:"current-jobs-ready"`
+	CurrentJobsReserved int    `yaml:"current-jobs-reserved"`
+	CurrentJobsDelayed  int    `yaml:"current-jobs-delayed"`
+	CurrentJobsBuried   int    `yaml:"current-jobs-buried"`
+	TotalJobs           int    `yaml:"total-jobs"`
+	CurrentWatching     int    `yaml:"current-watching"`
+}
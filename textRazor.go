@@ -3,10 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-querystring/query"
 	"gopkg.in/yaml.v2"
@@ -31,15 +32,6 @@ const (
 	ModeCleanHTML string = "cleanHTML"
 )
 
-var (
-	// ErrHTTPBadRequest error
-	ErrHTTPBadRequest = errors.New("Bad Request")
-	// ErrHTTPUnauthorized error
-	ErrHTTPUnauthorized = errors.New("Unauthorized")
-	// ErrHTTPRequestEntityTooLarge error
-	ErrHTTPRequestEntityTooLarge = errors.New("Request Entity Too Large")
-)
-
 // TextRazorRequest struct
 type TextRazorRequest struct {
 	Text                 string `form:"text,omitempty"                url:"text,omitempty"                yaml:"text,omitempty"`
@@ -66,13 +58,18 @@ func NewTextRazorRequest(key string) *TextRazorRequest {
 }
 
 // Analysis method
-func (t *TextRazorRequest) Analysis(client *http.Client) (*TextRazorResult, error) {
+// The request and any undecodable response are logged to log at the
+// debug level.
+func (t *TextRazorRequest) Analysis(client *http.Client, log *Logger) (*TextRazorResult, error) {
 	v, err := query.Values(t)
 	if err != nil {
 		return nil, err
 	}
 	s := v.Encode()
-	logInfo.Println(s)
+	if log.Enabled(LevelDebug) {
+		v.Del("apiKey")
+		log.Debugf("TextRazor request: %s", v.Encode())
+	}
 
 	req, err := http.NewRequest("POST", "https://api.textrazor.com/", bytes.NewBufferString(s))
 	if err != nil {
@@ -82,42 +79,43 @@ func (t *TextRazorRequest) Analysis(client *http.Client) (*TextRazorResult, erro
 	req.Header.Add("Accept-encoding: ", "gzip")
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		textRazorRequests.Inc("none")
+		return nil, NewTextRazorError(0, err.Error())
 	}
+	defer resp.Body.Close()
+	textRazorRequests.Inc(strconv.Itoa(resp.StatusCode))
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, NewTextRazorError(0, err.Error())
 	}
 
-	var tr TextRazorResult
-	tr.URL = t.URL
-	err = json.Unmarshal(data, &tr)
+	tr, err := NewTextRazorResult(t.URL, time.Now().UTC(), data)
+	if resp.StatusCode != http.StatusOK {
+		// Error bodies are JSON when TextRazor itself answered, but
+		// not when a proxy in front of it did
+		message := http.StatusText(resp.StatusCode)
+		if err == nil && tr.Error != "" {
+			message = tr.Error
+		}
+		return nil, NewTextRazorError(resp.StatusCode, message)
+	}
 	if err != nil {
-		logInfo.Printf("%s\n", data)
+		log.Debugf("TextRazor response: %s", data)
 		return nil, err
 	}
 
-	switch resp.StatusCode {
-	case http.StatusBadRequest:
-		return nil, ErrHTTPBadRequest
-	case http.StatusUnauthorized:
-		return nil, ErrHTTPUnauthorized
-	case http.StatusRequestEntityTooLarge:
-		return nil, ErrHTTPRequestEntityTooLarge
-	}
-
 	if !tr.Ok {
-		return nil, errors.New(tr.Error)
+		return nil, NewTextRazorError(resp.StatusCode, tr.Error)
 	}
 
-	return &tr, nil
+	return tr, nil
 }
 
 func (t *TextRazorRequest) String() string {
 	b, err := yaml.Marshal(t)
 	if err != nil {
-		logError.Fatal(err)
+		logger.Fatalf("%s", err)
 	}
 	return string(b)
 }
@@ -128,103 +126,172 @@ func (t *TextRazorRequest) SetExtractors(e ...string) {
 }
 
 // TextRazorResult struct
+// The decoded TextRazor v1 response envelope.
 type TextRazorResult struct {
-	URL              string
-	Time             float64
-	Response         TextRazorResponse
-	Ok               bool
-	Error            string
-	Message          string
-	CustomAnnotation string
-	CleanedText      string
-	RawText          string
+	URL         string            `json:"-"`
+	Time        float64           `json:"time"`
+	Response    TextRazorResponse `json:"response"`
+	Ok          bool              `json:"ok"`
+	Error       string            `json:"error"`
+	Message     string            `json:"message"`
+	AnalysedAt  time.Time         `json:"-"`
+	RawResponse []byte            `json:"-"` // the undecoded TextRazor response body
+}
+
+// NewTextRazorResult decodes the TextRazor response body data for url
+func NewTextRazorResult(url string, analysedAt time.Time, data []byte) (*TextRazorResult, error) {
+	tr := &TextRazorResult{
+		URL:         url,
+		AnalysedAt:  analysedAt,
+		RawResponse: data,
+	}
+
+	err := json.Unmarshal(data, tr)
+	if err != nil {
+		return nil, err
+	}
+
+	return tr, nil
 }
 
 // TextRazorResponse struct
 type TextRazorResponse struct {
-	Entailments        []TextRazorEntailment
-	Entities           []TypeRazorEntity
-	CoarseTopics       []TextRazorTopic
-	Topics             []TextRazorTopic
-	NounPhrases        []TextRazorNounPhrase
-	Properties         []TextRazorProperty
-	Relations          []TextRazorRelation
-	Sentences          []TextRazorSentence
-	MatchingRules      string
-	Language           string
-	LanguageIsReliable bool
+	Language               string                      `json:"language"`
+	LanguageIsReliable     bool                        `json:"languageIsReliable"`
+	Sentences              []TextRazorSentence         `json:"sentences"`
+	Entities               []TypeRazorEntity           `json:"entities"`
+	Topics                 []TextRazorTopic            `json:"topics"`
+	CoarseTopics           []TextRazorTopic            `json:"coarseTopics"`
+	Entailments            []TextRazorEntailment       `json:"entailments"`
+	Relations              []TextRazorRelation         `json:"relations"`
+	Properties             []TextRazorProperty         `json:"properties"`
+	NounPhrases            []TextRazorNounPhrase       `json:"nounPhrases"`
+	Categories             []TextRazorCategory         `json:"categories"`
+	MatchingRules          []string                    `json:"matchingRules"`
+	CustomAnnotations      []TextRazorCustomAnnotation `json:"customAnnotations"`
+	CustomAnnotationOutput string                      `json:"customAnnotationOutput"`
+	CleanedText            string                      `json:"cleanedText"`
+	RawText                string                      `json:"rawText"`
+}
+
+// TextRazorSentence struct
+type TextRazorSentence struct {
+	Position int             `json:"position"`
+	Words    []TextRazorWord `json:"words"`
+}
+
+// TextRazorWord struct
+// ParentPosition is nil for the root of a sentence's dependency tree.
+type TextRazorWord struct {
+	Position         int              `json:"position"`
+	StartingPos      int              `json:"startingPos"`
+	EndingPos        int              `json:"endingPos"`
+	Token            string           `json:"token"`
+	Lemma            string           `json:"lemma"`
+	Stem             string           `json:"stem"`
+	PartOfSpeech     string           `json:"partOfSpeech"`
+	ParentPosition   *int             `json:"parentPosition"`
+	RelationToParent string           `json:"relationToParent"`
+	Senses           []TextRazorSense `json:"senses"`
+}
+
+// TextRazorSense struct
+type TextRazorSense struct {
+	Synset string  `json:"synset"`
+	Score  float64 `json:"score"`
 }
 
 // TypeRazorEntity struct
 type TypeRazorEntity struct {
-	EntityID        string
-	EntityEnglishID string
-	ConfidenceScore float64
-	Type            string
-	FreebaseTypes   string
-	FreebaseID      string
-	MatchingTokens  string
-	MatchedText     string
-	Data            string
-	RelevanceScore  float64
-	WikiLink        string
+	ID              int                 `json:"id"`
+	EntityID        string              `json:"entityId"`
+	EntityEnglishID string              `json:"entityEnglishId"`
+	CustomEntityID  string              `json:"customEntityId"`
+	ConfidenceScore float64             `json:"confidenceScore"`
+	RelevanceScore  float64             `json:"relevanceScore"`
+	Type            []string            `json:"type"`
+	FreebaseTypes   []string            `json:"freebaseTypes"`
+	FreebaseID      string              `json:"freebaseId"`
+	WikidataID      string              `json:"wikidataId"`
+	WikiLink        string              `json:"wikiLink"`
+	MatchingTokens  []int               `json:"matchingTokens"`
+	MatchedText     string              `json:"matchedText"`
+	StartingPos     int                 `json:"startingPos"`
+	EndingPos       int                 `json:"endingPos"`
+	Data            map[string][]string `json:"data"`
 }
 
 // TextRazorTopic struct
 type TextRazorTopic struct {
-	ID       int
-	Label    string
-	Score    float64
-	WikiLink string
+	ID         int     `json:"id"`
+	Label      string  `json:"label"`
+	Score      float64 `json:"score"`
+	WikiLink   string  `json:"wikiLink"`
+	WikidataID string  `json:"wikidataId"`
 }
 
 // TextRazorEntailment struct
 type TextRazorEntailment struct {
-	ContextScore  int
-	EntailedTree  string
-	WordPositions string
-	PriorScore    string
-	Score         float64
+	ID            int                   `json:"id"`
+	WordPositions []int                 `json:"wordPositions"`
+	EntailedTree  TextRazorEntailedTree `json:"entailedTree"`
+	PriorScore    float64               `json:"priorScore"`
+	ContextScore  float64               `json:"contextScore"`
+	Score         float64               `json:"score"`
 }
 
-// TextRazorRelationParam struct
-type TextRazorRelationParam struct {
-	WordPositions string
-	Relation      string
+// TextRazorEntailedTree struct
+type TextRazorEntailedTree struct {
+	Word     string `json:"word"`
+	WordID   int    `json:"wordId"`
+	ParentID int    `json:"parentId"`
 }
 
-// TextRazorNounPhrase struct
-type TextRazorNounPhrase struct {
-	WordPositions string
+// TextRazorRelation struct
+type TextRazorRelation struct {
+	ID            int                      `json:"id"`
+	WordPositions []int                    `json:"wordPositions"`
+	Params        []TextRazorRelationParam `json:"params"`
+}
+
+// TextRazorRelationParam struct
+type TextRazorRelationParam struct {
+	Relation      string `json:"relation"`
+	WordPositions []int  `json:"wordPositions"`
 }
 
 // TextRazorProperty struct
 type TextRazorProperty struct {
-	WordPositions     string
-	PropertyPositions string
+	ID                int   `json:"id"`
+	WordPositions     []int `json:"wordPositions"`
+	PropertyPositions []int `json:"propertyPositions"`
 }
 
-// TextRazorRelation struct
-type TextRazorRelation struct {
-	Params        string
-	WordPositions string
+// TextRazorNounPhrase struct
+type TextRazorNounPhrase struct {
+	ID            int   `json:"id"`
+	WordPositions []int `json:"wordPositions"`
 }
 
-// TextRazorWord struct
-type TextRazorWord struct {
-	StartingPos      int
-	EndingPos        int
-	Lemma            string
-	ParentPosition   string
-	PartOfSpeech     string
-	Senses           string
-	Position         string
-	RelationToParent string
-	Stem             string
-	Token            string
+// TextRazorCategory struct
+type TextRazorCategory struct {
+	ID           int     `json:"id"`
+	ClassifierID string  `json:"classifierId"`
+	CategoryID   string  `json:"categoryId"`
+	Label        string  `json:"label"`
+	Score        float64 `json:"score"`
 }
 
-// TextRazorSentence struct
-type TextRazorSentence struct {
-	Words string
+// TextRazorCustomAnnotation struct
+// The output of a Prolog rule; Links reference words, entities and so on
+// and are left undecoded as their shape depends on the rule.
+type TextRazorCustomAnnotation struct {
+	Name     string                             `json:"name"`
+	Contents []TextRazorCustomAnnotationContent `json:"contents"`
+}
+
+// TextRazorCustomAnnotationContent struct
+type TextRazorCustomAnnotationContent struct {
+	Key   string            `json:"key"`
+	Links []json.RawMessage `json:"links"`
 }
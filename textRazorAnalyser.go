@@ -0,0 +1,152 @@
+package main
+
+import (
+	"time"
+)
+
+// ProviderTextRazor is the -provider name of the TextRazorAnalyser
+const ProviderTextRazor = "textrazor"
+
+// TextRazorAnalyser analyses articles with the TextRazor API, counting
+// each request against the daily quota. By default TextRazor downloads
+// the article itself; with fetchLocally nusetextd downloads it, strips
+// the boilerplate and posts just the article text, so sites blocking
+// TextRazor's crawler still work and dead links cost no quota. The
+// extracted text is sent with the raw cleanup mode, whatever the
+// profile's, as there is no HTML left to clean.
+type TextRazorAnalyser struct {
+	apiKey            string
+	downloadUserAgent string
+	timeout           time.Duration
+	fetchLocally      bool
+	profiles          *ExtractorProfiles
+}
+
+// NewTextRazorAnalyser TextRazorAnalyser constructor
+func NewTextRazorAnalyser(key string, timeout int, fetchLocally bool, profiles *ExtractorProfiles) *TextRazorAnalyser {
+	return &TextRazorAnalyser{
+		apiKey:            key,
+		downloadUserAgent: downloadUserAgent,
+		timeout:           time.Duration(timeout) * time.Second,
+		fetchLocally:      fetchLocally,
+		profiles:          profiles,
+	}
+}
+
+// Analyse method
+func (a *TextRazorAnalyser) Analyse(u *ArticleURL) (*Analysis, error) {
+	c := NewTimeoutClient(a.timeout)
+	tr := NewTextRazorRequest(a.apiKey)
+	a.profiles.ForArticle(u).Apply(tr)
+	if tr.LanguageOverride == "" {
+		tr.LanguageOverride = u.Meta.LanguageHint
+	}
+	tr.CleanupReturnCleaned = false
+	tr.CleanupReturnRaw = false
+
+	var fa *FetchedArticle
+	if a.fetchLocally {
+		var err error
+		fa, err = FetchArticle(c, u.String(), a.downloadUserAgent, u.Log())
+		if _, ok := err.(*CharsetError); ok {
+			// TextRazor decodes far more charsets
+			u.Log().Warnf("%s; letting TextRazor download it", err)
+			fa = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if fa != nil {
+		tr.Text = fa.MainText()
+		if tr.CleanupMode != ModeRaw {
+			u.Log().Debugf("Sending extracted text with cleanup mode %s rather than %s", ModeRaw, tr.CleanupMode)
+		}
+		tr.CleanupMode = ModeRaw
+	} else {
+		tr.DownloadUserAgent = a.downloadUserAgent
+		tr.URL = u.String()
+	}
+
+	err := quota.Take(u.Log())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tr.Analysis(c, u.Log())
+	if err != nil {
+		return nil, err
+	}
+	result.URL = u.String()
+
+	analysis := result.Analysis()
+	if fa != nil {
+		analysis.Fetch = fa.Info()
+	}
+
+	return analysis, nil
+}
+
+// Analysis converts the TextRazorResult to the provider neutral model
+func (r *TextRazorResult) Analysis() *Analysis {
+	a := &Analysis{
+		URL:                r.URL,
+		Provider:           ProviderTextRazor,
+		AnalysedAt:         r.AnalysedAt,
+		Language:           r.Response.Language,
+		LanguageIsReliable: r.Response.LanguageIsReliable,
+		Raw:                r.RawResponse,
+	}
+
+	for _, t := range r.Response.Topics {
+		a.Topics = append(a.Topics, t.Topic())
+	}
+
+	for _, t := range r.Response.CoarseTopics {
+		a.CoarseTopics = append(a.CoarseTopics, t.Topic())
+	}
+
+	for _, e := range r.Response.Entities {
+		a.Entities = append(a.Entities, Entity{
+			ID:             e.EntityID,
+			EnglishID:      e.EntityEnglishID,
+			Types:          e.Type,
+			FreebaseTypes:  e.FreebaseTypes,
+			FreebaseID:     e.FreebaseID,
+			WikidataID:     e.WikidataID,
+			WikiLink:       e.WikiLink,
+			MatchedText:    e.MatchedText,
+			MatchingTokens: e.MatchingTokens,
+			Data:           e.Data,
+			Confidence:     e.ConfidenceScore,
+			Relevance:      e.RelevanceScore,
+		})
+	}
+
+	for _, s := range r.Response.Sentences {
+		sentence := Sentence{Position: s.Position}
+		for _, w := range s.Words {
+			sentence.Words = append(sentence.Words, Word{
+				Position:     w.Position,
+				StartingPos:  w.StartingPos,
+				EndingPos:    w.EndingPos,
+				Token:        w.Token,
+				Lemma:        w.Lemma,
+				Stem:         w.Stem,
+				PartOfSpeech: w.PartOfSpeech,
+			})
+		}
+		a.Sentences = append(a.Sentences, sentence)
+	}
+
+	return a
+}
+
+// Topic converts the TextRazorTopic to the provider neutral model
+func (t TextRazorTopic) Topic() Topic {
+	return Topic{
+		Label:      t.Label,
+		Score:      t.Score,
+		WikiLink:   t.WikiLink,
+		WikidataID: t.WikidataID,
+	}
+}
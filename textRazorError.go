@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// TextRazorErrorClass says what a worker should do about a TextRazorError
+type TextRazorErrorClass int
+
+// TextRazor error classes
+const (
+	// TextRazorRetryable errors are transient; the article should be
+	// tried again later (5xx responses, network failures, timeouts)
+	TextRazorRetryable TextRazorErrorClass = iota
+	// TextRazorQuota errors mean TextRazor is refusing requests for
+	// now (429); retryable, but another provider may be used meanwhile
+	TextRazorQuota
+	// TextRazorPermanent errors will recur for this article however
+	// often it is retried (400, 413 and other 4xx responses)
+	TextRazorPermanent
+	// TextRazorFatal errors will recur for every article until the
+	// configuration is fixed (401)
+	TextRazorFatal
+)
+
+func (c TextRazorErrorClass) String() string {
+	switch c {
+	case TextRazorRetryable:
+		return "retryable"
+	case TextRazorQuota:
+		return "quota"
+	case TextRazorPermanent:
+		return "permanent"
+	case TextRazorFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("TextRazorErrorClass(%d)", int(c))
+}
+
+// TextRazorError is returned by TextRazorRequest.Analysis for any
+// failed request. StatusCode is 0 when no response was received.
+type TextRazorError struct {
+	StatusCode int
+	Message    string
+	Class      TextRazorErrorClass
+}
+
+// NewTextRazorError constructor
+// Classifies the error by its HTTP status code.
+func NewTextRazorError(statusCode int, message string) *TextRazorError {
+	return &TextRazorError{
+		StatusCode: statusCode,
+		Message:    message,
+		Class:      classifyStatus(statusCode),
+	}
+}
+
+func (e *TextRazorError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("TextRazor request failed: %s", e.Message)
+	}
+	return fmt.Sprintf("TextRazor %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Retryable method
+func (e *TextRazorError) Retryable() bool {
+	return e.Class == TextRazorRetryable || e.Class == TextRazorQuota
+}
+
+// classifyStatus maps a TextRazor HTTP status code to its error class
+func classifyStatus(statusCode int) TextRazorErrorClass {
+	switch {
+	case statusCode == 0:
+		return TextRazorRetryable
+	case statusCode == http.StatusUnauthorized:
+		return TextRazorFatal
+	case statusCode == http.StatusTooManyRequests:
+		return TextRazorQuota
+	case statusCode >= 500:
+		return TextRazorRetryable
+	}
+	return TextRazorPermanent
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readGolden returns the recorded response in testdata/name
+func readGolden(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNewTextRazorResult(t *testing.T) {
+	analysedAt := time.Date(2017, 3, 14, 9, 26, 53, 0, time.UTC)
+	data := readGolden(t, "textrazor_full.json")
+
+	tr, err := NewTextRazorResult("http://example.com/obama-paris", analysedAt, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tr.Ok || tr.Error != "" {
+		t.Errorf("Ok %v, Error %q; want true, none", tr.Ok, tr.Error)
+	}
+	if tr.URL != "http://example.com/obama-paris" || !tr.AnalysedAt.Equal(analysedAt) {
+		t.Errorf("URL %q, AnalysedAt %s not kept", tr.URL, tr.AnalysedAt)
+	}
+	if string(tr.RawResponse) != string(data) {
+		t.Errorf("RawResponse is not the response body")
+	}
+
+	r := tr.Response
+	if r.Language != "eng" || !r.LanguageIsReliable {
+		t.Errorf("Language %q reliable %v, want eng true", r.Language, r.LanguageIsReliable)
+	}
+
+	// words, dependencies and senses
+	if len(r.Sentences) != 2 || len(r.Sentences[0].Words) != 5 || len(r.Sentences[1].Words) != 5 {
+		t.Fatalf("Sentences %+v, want 2 of 5 words", r.Sentences)
+	}
+	visited := r.Sentences[0].Words[2]
+	if visited.Token != "visited" || visited.Lemma != "visit" || visited.PartOfSpeech != "VBD" || visited.StartingPos != 13 || visited.EndingPos != 20 {
+		t.Errorf("word 2 is %+v", visited)
+	}
+	if visited.ParentPosition != nil || visited.RelationToParent != "root" {
+		t.Errorf("word 2 parent %v %q, want the root", visited.ParentPosition, visited.RelationToParent)
+	}
+	wantSenses := []TextRazorSense{{Synset: "visit.v.01", Score: 0.714}, {Synset: "visit.v.02", Score: 0.201}}
+	if !reflect.DeepEqual(visited.Senses, wantSenses) {
+		t.Errorf("word 2 senses %+v, want %+v", visited.Senses, wantSenses)
+	}
+	macron := r.Sentences[1].Words[3]
+	if macron.ParentPosition == nil || *macron.ParentPosition != 6 || macron.RelationToParent != "dobj" {
+		t.Errorf("word 8 parent %v %q, want 6 dobj", macron.ParentPosition, macron.RelationToParent)
+	}
+
+	// entities
+	if len(r.Entities) != 3 {
+		t.Fatalf("%d entities, want 3", len(r.Entities))
+	}
+	obama := r.Entities[0]
+	if obama.EntityID != "Barack Obama" || obama.WikidataID != "Q76" || obama.FreebaseID != "/m/02mjmr" || obama.ConfidenceScore != 12.17 || obama.RelevanceScore != 0.7936 {
+		t.Errorf("entity 0 is %+v", obama)
+	}
+	if !reflect.DeepEqual(obama.Type, []string{"Agent", "Person", "Politician"}) ||
+		!reflect.DeepEqual(obama.FreebaseTypes, []string{"/people/person", "/government/politician"}) ||
+		!reflect.DeepEqual(obama.MatchingTokens, []int{0, 1}) {
+		t.Errorf("entity 0 types %v %v, tokens %v", obama.Type, obama.FreebaseTypes, obama.MatchingTokens)
+	}
+	custom := r.Entities[2]
+	wantData := map[string][]string{"role": {"President of France"}, "party": {"La République En Marche!"}}
+	if custom.CustomEntityID != "french_leaders" || !reflect.DeepEqual(custom.Data, wantData) {
+		t.Errorf("entity 2 custom id %q, data %v", custom.CustomEntityID, custom.Data)
+	}
+
+	// topics and categories
+	if len(r.Topics) != 2 || r.Topics[1].Label != "Diplomacy" || r.Topics[1].Score != 0.8743 || r.Topics[1].WikidataID != "Q1643932" {
+		t.Errorf("Topics %+v", r.Topics)
+	}
+	if len(r.CoarseTopics) != 1 || r.CoarseTopics[0].Label != "Politics" {
+		t.Errorf("CoarseTopics %+v", r.CoarseTopics)
+	}
+	wantCategory := TextRazorCategory{ID: 1, ClassifierID: "textrazor_iab_content_taxonomy", CategoryID: "379", Label: "News and Politics>International News", Score: 0.4402}
+	if len(r.Categories) != 2 || r.Categories[1] != wantCategory {
+		t.Errorf("Categories %+v, want second %+v", r.Categories, wantCategory)
+	}
+
+	// relations, properties, noun phrases and entailments
+	wantRelation := TextRazorRelation{
+		ID:            1,
+		WordPositions: []int{6},
+		Params: []TextRazorRelationParam{
+			{Relation: "SUBJECT", WordPositions: []int{5}},
+			{Relation: "OBJECT", WordPositions: []int{7, 8}},
+		},
+	}
+	if len(r.Relations) != 2 || !reflect.DeepEqual(r.Relations[1], wantRelation) {
+		t.Errorf("Relations %+v, want second %+v", r.Relations, wantRelation)
+	}
+	wantProperty := TextRazorProperty{ID: 0, WordPositions: []int{1}, PropertyPositions: []int{0}}
+	if len(r.Properties) != 1 || !reflect.DeepEqual(r.Properties[0], wantProperty) {
+		t.Errorf("Properties %+v, want %+v", r.Properties, wantProperty)
+	}
+	if len(r.NounPhrases) != 2 || !reflect.DeepEqual(r.NounPhrases[1].WordPositions, []int{7, 8}) {
+		t.Errorf("NounPhrases %+v", r.NounPhrases)
+	}
+	if len(r.Entailments) != 1 || r.Entailments[0].EntailedTree.Word != "travel" || r.Entailments[0].EntailedTree.ParentID != -1 || r.Entailments[0].Score != 0.2247 {
+		t.Errorf("Entailments %+v", r.Entailments)
+	}
+
+	// custom annotations
+	if !reflect.DeepEqual(r.MatchingRules, []string{"meeting"}) {
+		t.Errorf("MatchingRules %v", r.MatchingRules)
+	}
+	if len(r.CustomAnnotations) != 1 || r.CustomAnnotations[0].Name != "meeting" || len(r.CustomAnnotations[0].Contents) != 2 {
+		t.Fatalf("CustomAnnotations %+v", r.CustomAnnotations)
+	}
+	guest := r.CustomAnnotations[0].Contents[1]
+	if guest.Key != "guest" || len(guest.Links) != 2 || string(guest.Links[1]) != `{"annotationName": "word", "linkedId": 8}` {
+		t.Errorf("annotation content 1 is %s %s", guest.Key, guest.Links)
+	}
+	if r.CustomAnnotationOutput != "meeting(Barack Obama, Emmanuel Macron)\n" {
+		t.Errorf("CustomAnnotationOutput %q", r.CustomAnnotationOutput)
+	}
+}
+
+func TestNewTextRazorResultError(t *testing.T) {
+	tr, err := NewTextRazorResult("http://example.com/", time.Now(), readGolden(t, "textrazor_error.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tr.Ok || tr.Error != "Request cannot be processed. Please check the provided text or URL." {
+		t.Errorf("Ok %v, Error %q", tr.Ok, tr.Error)
+	}
+	if tr.Response.Language != "" || tr.Response.Entities != nil {
+		t.Errorf("Response %+v, want none", tr.Response)
+	}
+}
+
+func TestNewTextRazorResultBadJSON(t *testing.T) {
+	_, err := NewTextRazorResult("http://example.com/", time.Now(), []byte("<html>502 Bad Gateway</html>"))
+	if err == nil {
+		t.Error("no error decoding HTML")
+	}
+}
+
+func TestTextRazorResultAnalysis(t *testing.T) {
+	analysedAt := time.Date(2017, 3, 14, 9, 26, 53, 0, time.UTC)
+	tr, err := NewTextRazorResult("http://example.com/obama-paris", analysedAt, readGolden(t, "textrazor_full.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := tr.Analysis()
+	if a.URL != "http://example.com/obama-paris" || a.Provider != ProviderTextRazor || !a.AnalysedAt.Equal(analysedAt) {
+		t.Errorf("Analysis URL %q, provider %q, at %s", a.URL, a.Provider, a.AnalysedAt)
+	}
+	if a.Language != "eng" || !a.LanguageIsReliable {
+		t.Errorf("Analysis language %q reliable %v", a.Language, a.LanguageIsReliable)
+	}
+	if string(a.Raw) != string(tr.RawResponse) {
+		t.Errorf("Analysis Raw is not the response body")
+	}
+
+	wantTopics := []Topic{
+		{Label: "Politics", Score: 1, WikiLink: "http://en.wikipedia.org/Category:Politics", WikidataID: "Q7163"},
+		{Label: "Diplomacy", Score: 0.8743, WikiLink: "http://en.wikipedia.org/Category:Diplomacy", WikidataID: "Q1643932"},
+	}
+	if !reflect.DeepEqual(a.Topics, wantTopics) {
+		t.Errorf("Topics %+v, want %+v", a.Topics, wantTopics)
+	}
+	if !reflect.DeepEqual(a.CoarseTopics, wantTopics[:1]) {
+		t.Errorf("CoarseTopics %+v, want %+v", a.CoarseTopics, wantTopics[:1])
+	}
+
+	wantEntity := Entity{
+		ID:             "Emmanuel Macron",
+		EnglishID:      "Emmanuel Macron",
+		Types:          []string{"Agent", "Person", "Politician"},
+		FreebaseTypes:  []string{"/people/person"},
+		FreebaseID:     "/m/011ncr8c",
+		WikidataID:     "Q3052772",
+		WikiLink:       "http://en.wikipedia.org/wiki/Emmanuel_Macron",
+		MatchedText:    "Emmanuel Macron",
+		MatchingTokens: []int{7, 8},
+		Data:           map[string][]string{"role": {"President of France"}, "party": {"La République En Marche!"}},
+		Confidence:     9.04,
+		Relevance:      0.6821,
+	}
+	if len(a.Entities) != 3 || !reflect.DeepEqual(a.Entities[2], wantEntity) {
+		t.Errorf("Entities %+v, want third %+v", a.Entities, wantEntity)
+	}
+
+	if len(a.Sentences) != 2 || a.Sentences[1].Position != 1 || len(a.Sentences[1].Words) != 5 {
+		t.Fatalf("Sentences %+v", a.Sentences)
+	}
+	wantWord := Word{Position: 6, StartingPos: 31, EndingPos: 34, Token: "met", Lemma: "meet", Stem: "met", PartOfSpeech: "VBD"}
+	if a.Sentences[1].Words[1] != wantWord {
+		t.Errorf("word 6 is %+v, want %+v", a.Sentences[1].Words[1], wantWord)
+	}
+}
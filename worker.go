@@ -1,92 +1,212 @@
 package main
 
 import (
-	beanstalk "github.com/JalfResi/gobeanstalk"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
 )
 
+// worker loop stages, as logged and timed
+const (
+	StageReserve string = "reserve"
+	StageAnalyse string = "analyse"
+	StageStore   string = "store"
+	StagePublish string = "publish"
+)
+
+// workerIDs numbers the workers started, for their log lines
+var workerIDs uint64
+
 // WorkerConfig struct
 type WorkerConfig struct {
-	srcTube          string
+	srcTubes         []SourceTube
+	srcTubeOrder     string
 	destTube         string
 	beanstalkdHost   string
+	beanstalkOutage  int
 	memcachedbHost   string
+	provider         string
+	fallbackProvider string
+	textRazorAPIKey  string
+	fetchLocally     bool
+	profiles         *ExtractorProfiles
+	cacheTTL         int
 	maxRetryAttempts uint64
 	timeout          int
-	mysqlHost        string
-	mysqlUsername    string
-	mysqlPassword    string
+	db               *sql.DB
+
+	backlogPolicy          string
+	backlogMaxAge          int
+	backlogPriorityPenalty uint
 }
 
 // Worker chan
 type Worker chan struct{}
 
 // DoWork does the following:
-// - Pulls a URL out of the srcTube
-// - Makes a GET/POST request to textrazor
+// - Pulls a URL out of the srcTubes
+// - Makes a GET/POST request to the analysis provider (e.g. textrazor)
 // - Stores the results in MySQL
+// - Creates a new job in destTube with the URL and an analysis summary
 // - Deletes the job from Beanstalk
-// - Creates a new job in destTube with the URL
 //
 // So we will need:
 // - An ArticleSupplier to read article urls from the queue
 // - An ArticleURL to represent an article url
-// - An ReportRecorder to store the returned TextRazor report
-// - An ArticleAnalyser to contact TextRazor and return a TextRazor report
+// - An ReportRecorder to store the returned Analysis
+// - An ArticleAnalyser to contact the -provider and return an Analysis
+// - An ArticlePublisher to pass the analysed article on to destTube
 // -
 //
+// DoWork returns once the Worker is closed by DieGracefully, after
+// finishing whatever job it currently holds.
 func (w Worker) DoWork(c *WorkerConfig) {
 
 	// The following is a worker
+	log := logger.With("worker", atomic.AddUint64(&workerIDs, 1))
+	workerHealth.Beat(w)
+	defer workerHealth.Forget(w)
 
 	// Connect to beanstalkd
-	bs, err := beanstalk.Dial(c.beanstalkdHost)
-	if err != nil {
-		logError.Fatalf("Beanstalk connect failed: %s\n", err)
+	bs := NewBeanstalkConn(c.beanstalkdHost, time.Duration(c.beanstalkOutage)*time.Second, log)
+	if !bs.Connect(w) {
+		log.Infof("Worker stopping")
+		return
 	}
 
-	as := NewArticleSupplier(bs, c.timeout, c.srcTube)
-	aa := NewAnalyser(config.textRazorAPIKey)
-	rr := NewReportRecorder(c.mysqlHost, c.mysqlUsername, c.mysqlPassword)
+	schedule, err := NewTubeSchedule(c.srcTubes, c.srcTubeOrder)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	as := NewArticleSupplier(bs, c.maxRetryAttempts, NewFailureLog(c.db), schedule, log)
+	defer as.Close()
+	aa, err := NewArticleAnalyser(c)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if c, ok := aa.(closer); ok {
+		defer c.Close()
+	}
+	rr := NewReportRecorder(c.db)
+	ap := NewArticlePublisher(bs, c.destTube, c.timeout)
+	bp, err := NewBacklogPolicy(c.backlogPolicy, c.backlogMaxAge, c.backlogPriorityPenalty)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
 
 	for {
-		article := as.GetArticleURL()
-		report, err := aa.Analyse(article)
+		start := time.Now()
+		article := as.GetArticleURL(w)
+		if article == nil {
+			log.Infof("Worker stopping")
+			return
+		}
+		stageDuration.Since(start, StageReserve)
+
+		// The connection must not be used again until the heartbeat
+		// has stopped
+		article.SetStage(StageAnalyse)
+		hb := as.Heartbeat(article)
+		start = time.Now()
+		analysis, err := aa.Analyse(article)
+		stageDuration.Since(start, StageAnalyse)
+		var storeErr error
+		if err == nil {
+			article.SetStage(StageStore)
+			start = time.Now()
+			storeErr = rr.Store(article, analysis)
+			stageDuration.Since(start, StageStore)
+		}
+		hb.Stop()
+
 		if err != nil {
 			if err == ErrRequestLimitMet {
-				logError.Printf("%s: %d\n", err, config.totalRequestLimit)
-				w.DieGracefully()
-				// should possibly wait until the next day
-				// reset the config.currentRequestCount and
-				// start up the number of workers to continue
-				// for the next day?
-				//
-				// What do we do about articleUrls that may be building up in
-				// beanstalkd? Should we bin off old (i.e. yesterday)
-				// article urls to deal with the backlog? Maybe we can
-				// bury them? (but then how do we deal with the bury list?)
-				return
+				// The backlog policy decides what happens to the
+				// article until the quota resets. Unless it says to
+				// sleep, we carry on reserving so the policy is
+				// applied to everything building up in the tube.
+				resetAt := quota.ResetAt()
+				if !bp.Apply(as, article, resetAt) {
+					continue
+				}
+
+				article.Log().Warnf("%s: %d; sleeping until %s", err, quota.Limit(), resetAt)
+				workerHealth.Sleep(w, resetAt)
+				select {
+				case <-w:
+					log.Infof("Worker stopping")
+					return
+				case <-time.After(time.Until(resetAt)):
+				}
+				continue
+			}
+
+			tubeStats.Failed(article.stats.Tube)
+			if tre, ok := err.(*TextRazorError); ok {
+				switch tre.Class {
+				case TextRazorFatal:
+					as.Defer(article, article.Priority(), 0)
+					article.Log().Fatalf("%s; check the -key option", err)
+				case TextRazorPermanent:
+					as.Bury(article, err)
+					article.Log().Errorf("%s; burying", err)
+					continue
+				}
 			}
 
-			if err.Error() == "Unauthorized" {
-				as.Retry(article)
-				logInfo.Printf("Got '%s' from TextRazor. Retrying\n", err)
+			if isProviderUnavailable(err) {
+				as.Retry(article, err)
+				continue
+			}
+			if fe, ok := err.(*FetchError); ok && fe.Retryable() {
+				as.Retry(article, err)
 				continue
 			}
 
-			logError.Printf("%+v %T\n", err, err)
-			// Possibly bury continuinly failing jobs?
+			article.Log().Errorf("Analysis failed; deleting: %s (%T)", err, err)
 			as.Done(article)
 			continue
 		}
-		as.Done(article)
-		err = rr.StoreTopics(report)
+
+		if storeErr != nil {
+			tubeStats.Failed(article.stats.Tube)
+			// With -memcache the analysis is cached, so the retry
+			// does not spend quota again
+			as.Retry(article, fmt.Errorf("Store failed: %s", storeErr))
+			continue
+		}
+		tubeStats.Analysed(article.stats.Tube)
+
+		article.SetStage(StagePublish)
+		start = time.Now()
+		err = ap.Publish(article, analysis)
+		stageDuration.Since(start, StagePublish)
 		if err != nil {
-			logError.Println(err)
+			err = fmt.Errorf("Publish to %s failed: %s", c.destTube, err)
+			if c.memcachedbHost != "" {
+				// Re-analysis is a cache hit and storing again is
+				// harmless, so put the job back rather than lose it
+				as.Retry(article, err)
+				continue
+			}
+
+			// Without the cache a retry would spend quota analysing
+			// the article again; bury it to be kicked by hand
+			as.Bury(article, err)
+			article.Log().Errorf("%s; burying", err)
+			continue
 		}
+		as.Done(article)
 	}
 }
 
 // DieGracefully method
+// Safe to call more than once.
 func (w Worker) DieGracefully() {
-	close(w)
+	select {
+	case <-w:
+	default:
+		close(w)
+	}
 }